@@ -10,6 +10,7 @@ func main() {
 	e := echo.New()
 	h := handler.NewHandler(config.Cfg)
 	e.GET("/file", h.GetFileData)
+	e.GET("/dir", h.GetDirData)
 	e.POST("/file", h.PostFileData)
 	e.PUT("/file", h.PutFileData)
 	e.DELETE("/file", h.DeleteFileData)
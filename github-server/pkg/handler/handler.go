@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/exec"
@@ -58,21 +59,97 @@ func updateGithubWithLocal(editFunc func() error, commitMessage string) error {
 	return nil
 }
 
+// errInvalidRef is returned by showFileAt for a ref that is not a git revision.
+var errInvalidRef = errors.New("invalid ref")
+
+// showFileAt returns the content of filePath at the git revision ref such as a commit hash or HEAD~1.
+func (h *handler) showFileAt(ref string, filePath string) ([]byte, error) {
+	if strings.HasPrefix(ref, "-") || strings.ContainsAny(ref, ": \t\n") {
+		return nil, fmt.Errorf("showFileAt: %w %v", errInvalidRef, ref)
+	}
+	// ./ makes the path relative to GitRepoPath instead of the top of the repository
+	object := ref + ":./" + strings.TrimPrefix(filepath.Clean("/"+filePath), "/")
+	out, err := exec.Command("git", "-C", h.config.GitRepoPath, "show", object).Output()
+	if err != nil {
+		return nil, fmt.Errorf("showFileAt: %w: %v", err, object)
+	}
+	return out, nil
+}
+
+// repoPath returns the cleaned path of filePath in GitRepoPath, and an error if it is outside of GitRepoPath.
+func (h *handler) repoPath(filePath string) (string, error) {
+	root := filepath.Clean(h.config.GitRepoPath)
+	result := filepath.Clean(h.config.GitRepoPath + filePath)
+	rel, err := filepath.Rel(root, result)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("repoPath: %v is outside of the repository", filePath)
+	}
+	return result, nil
+}
+
+// commitMessage returns the commit message of a file request. The path is used when no message is given.
+func commitMessage(req model.ReqStringData) string {
+	if req.CommitMessage != "" {
+		return req.CommitMessage
+	}
+	return req.Path
+}
+
 func (h *handler) GetFileData(c echo.Context) error {
 	filePath := c.QueryParam("path")
 	if filePath == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "query parameter for file path does not exist:")
 	}
+	if ref := c.QueryParam("ref"); ref != "" {
+		bytes, err := h.showFileAt(ref, filePath)
+		if errors.Is(err, errInvalidRef) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("GetFileData: %v", err))
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("GetFileData: %v", err))
+		}
+		return c.JSON(http.StatusOK, model.StringData{StringData: string(bytes)})
+	}
 	fmt.Println("GetFileData: ", h.config.GitRepoPath+filePath)
 	bytes, err := os.ReadFile(h.config.GitRepoPath + filePath)
 	if err != nil {
 		fmt.Println(err, "check")
+		if errors.Is(err, fs.ErrNotExist) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("GetFileData: %v", err))
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("GetFileData: %v", err))
 	}
 	fmt.Println("GetFileData: ", string(bytes))
 	return c.JSON(http.StatusOK, model.StringData{StringData: string(bytes)})
 }
 
+func (h *handler) GetDirData(c echo.Context) error {
+	dirPath := c.QueryParam("path")
+	if dirPath == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "query parameter for directory path does not exist:")
+	}
+	fullPath, err := h.repoPath(dirPath)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("GetDirData: %v", err))
+	}
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("GetDirData: %v", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("GetDirData: %v", err))
+	}
+	result := model.DirData{Entries: make([]model.DirEntry, 0, len(entries))}
+	for _, v := range entries {
+		// skip hidden files such as .git
+		if strings.HasPrefix(v.Name(), ".") {
+			continue
+		}
+		result.Entries = append(result.Entries, model.DirEntry{Name: v.Name(), IsDir: v.IsDir()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
 func (h *handler) PostFileData(c echo.Context) error {
 	var req model.ReqStringData
 	post_option := c.Request().Header.Get("X-POST-OPTION")
@@ -116,7 +193,7 @@ func (h *handler) PostFileData(c echo.Context) error {
 		return nil
 	}
 
-	err = updateGithubWithLocal(editFunc, req.Path)
+	err = updateGithubWithLocal(editFunc, commitMessage(req))
 	if err != nil {
 		fmt.Println(err)
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("PostFileData: %v", err))
@@ -156,7 +233,7 @@ func (h *handler) PutFileData(c echo.Context) error {
 		}
 		return errors.New("no such file")
 	}
-	err = updateGithubWithLocal(editFunc, req.Path)
+	err = updateGithubWithLocal(editFunc, commitMessage(req))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("PutFileData: %v", err))
 	}
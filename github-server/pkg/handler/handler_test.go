@@ -20,12 +20,26 @@ import (
 
 var (
 	// TestGetFileData.
-	getPaths        = []string{"testdata/testJson.json"}
+	getPaths        = []string{"testdata/testJson.json", "testdata/none.json"}
 	expectedGetJson = []string{
 		"{\"string_data\":\"{\\n    \\\"test\\\": \\\"testjson\\\"\\n}\"}\n",
+		"",
+	}
+	wantGetStatus = []int{http.StatusOK, http.StatusOK}
+	wantGetErrors = []error{nil, echo.NewHTTPError(http.StatusNotFound, "GetFileData: open ./testdata/none.json: no such file or directory")}
+	// TestGetDirData.
+	getDirPaths        = []string{"testdata/dir", "testdata/none", "testdata/../../"}
+	expectedGetDirJson = []string{
+		"{\"entries\":[{\"name\":\"a.json\",\"is_dir\":false},{\"name\":\"b\",\"is_dir\":true}]}\n",
+		"",
+		"",
+	}
+	wantGetDirStatus = []int{http.StatusOK, http.StatusOK, http.StatusOK}
+	wantGetDirErrors = []error{
+		nil,
+		echo.NewHTTPError(http.StatusNotFound, "GetDirData: open testdata/none: no such file or directory"),
+		echo.NewHTTPError(http.StatusBadRequest, "GetDirData: repoPath: testdata/../../ is outside of the repository"),
 	}
-	wantGetStatus = []int{http.StatusOK}
-	wantGetErrors = []error{nil}
 	// TestPostFileDatas.
 	postDatas = []string{
 		`{"path": "path", "string_data": "{\"aa\":\"test\"}"}`,
@@ -111,7 +125,7 @@ func (h *TestHandler) PostFileData(c echo.Context) error {
 	}
 
 	// for test
-	err = updateGithubWithLocalForTest(editFunc, req.Path)
+	err = updateGithubWithLocalForTest(editFunc, commitMessage(req))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("PostFileData: %v", err))
 	}
@@ -151,7 +165,7 @@ func (h *TestHandler) PutFileData(c echo.Context) error {
 		return errors.New("no such file")
 	}
 	// for test
-	err = updateGithubWithLocalForTest(editFunc, req.Path)
+	err = updateGithubWithLocalForTest(editFunc, commitMessage(req))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("PutFileData: %v", err))
 	}
@@ -199,7 +213,7 @@ func TestGetFileData(t *testing.T) {
 		want       string
 		wantErr    error
 	}
-	testNames := []string{"正常系: POST成功"}
+	testNames := []string{"正常系: POST成功", "異常系: ファイルが存在しない"}
 	tests := make(map[string]test)
 	for i, name := range testNames {
 		tests[name] = test{
@@ -225,6 +239,66 @@ func TestGetFileData(t *testing.T) {
 	}
 }
 
+func TestGetFileDataAtRef(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		ref     string
+		wantErr error
+	}
+	tests := map[string]test{
+		"異常系: オプションのようなref": {
+			ref:     "--output=x",
+			wantErr: echo.NewHTTPError(http.StatusBadRequest, "GetFileData: showFileAt: invalid ref --output=x"),
+		},
+		"異常系: 空白を含むref": {
+			ref:     "HEAD%20x",
+			wantErr: echo.NewHTTPError(http.StatusBadRequest, "GetFileData: showFileAt: invalid ref HEAD x"),
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/file?path=%v&ref=%v", getPaths[0], tt.ref), nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			assert.Equal(t, tt.wantErr, testHandler.GetFileData(c))
+		})
+	}
+}
+
+func TestGetDirData(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		arg1       string
+		wantStatus int
+		want       string
+		wantErr    error
+	}
+	testNames := []string{"正常系: ディレクトリ一覧取得成功", "異常系: ディレクトリが存在しない", "異常系: リポジトリ外のパス"}
+	tests := make(map[string]test)
+	for i, name := range testNames {
+		tests[name] = test{
+			arg1:       getDirPaths[i],
+			wantStatus: wantGetDirStatus[i],
+			want:       expectedGetDirJson[i],
+			wantErr:    wantGetDirErrors[i],
+		}
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/dir?path=%v", tt.arg1), nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			assert.Equal(t, tt.wantErr, testHandler.GetDirData(c))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.want, rec.Body.String())
+		})
+	}
+}
+
 func TestPostFileData(t *testing.T) {
 	t.Parallel()
 	type test struct {
@@ -323,3 +397,28 @@ func TestDeleteFileData(t *testing.T) {
 		})
 	}
 }
+
+func TestCommitMessage(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		arg  model.ReqStringData
+		want string
+	}
+	tests := map[string]test{
+		"正常系: メッセージ指定なし": {
+			arg:  model.ReqStringData{Path: "/Devices/deviceA/set.json"},
+			want: "/Devices/deviceA/set.json",
+		},
+		"正常系: メッセージ指定あり": {
+			arg:  model.ReqStringData{Path: "/Devices/deviceA/set.json", CommitMessage: "Update deviceA\n\n+mtu"},
+			want: "Update deviceA\n\n+mtu",
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, commitMessage(tt.arg))
+		})
+	}
+}
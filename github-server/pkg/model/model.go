@@ -7,4 +7,15 @@ type StringData struct {
 type ReqStringData struct {
 	Path       string `json:"path"`
 	StringData string `json:"string_data"`
+	// CommitMessage, if set, is used as the commit message instead of Path.
+	CommitMessage string `json:"commit_message,omitempty"`
+}
+
+type DirEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+}
+
+type DirData struct {
+	Entries []DirEntry `json:"entries"`
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/labstack/echo"
 	"github.com/nttcom/ksot/nb-server/pkg/config"
 	"github.com/nttcom/ksot/nb-server/pkg/handler"
@@ -8,12 +10,31 @@ import (
 
 func main() {
 	e := echo.New()
-	h := handler.NewHandler(config.Cfg)
+	e.HTTPErrorHandler = handler.HTTPErrorHandler
+	h, err := handler.NewHandler(config.Cfg)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	e.GET("/services", h.ListServices)
 	e.GET("/services/:service", h.GetService)
+	e.GET("/services/:service/devices", h.GetServiceDevices)
+	e.GET("/devices", h.ListDevices)
 	e.GET("/devices/:device", h.GetDevice)
+	e.GET("/devices/:device/services", h.GetDeviceServices)
+	e.GET("/devices/:device/owner", h.GetDeviceOwner)
+	e.GET("/devices/:device/paths", h.GetDevicePaths)
+	e.GET("/devices/:device/drift", h.GetDeviceDrift)
+	e.GET("/devices/:device/diff", h.GetDeviceDiff)
+	e.GET("/drift", h.GetDrift)
+	e.GET("/reconciliations", h.GetReconciliations)
+	e.POST("/reconciliations", h.RunReconciliation)
 	e.POST("/services", h.CreateServices)
 	e.PUT("/services", h.UpdateServices)
+	e.PATCH("/services/:service", h.PatchService)
 	e.DELETE("/services", h.DeleteServices)
 	e.PUT("/sync/devices", h.SyncDevices)
+	e.GET("/transactions", h.ListTransactions)
+	e.GET("/transactions/:id", h.GetTransaction)
+	go h.RunReconciler(context.Background())
 	e.Logger.Fatal(e.Start(":8080"))
 }
@@ -17,11 +17,13 @@ var (
 	Github = &githubAPI{
 		&api{
 			baseURL: config.Cfg.GithubServerURL,
+			timeout: config.Cfg.APITimeout,
 		},
 	}
 	Sb = &sbAPI{
 		&api{
 			baseURL: config.Cfg.SbServerURL,
+			timeout: config.Cfg.APITimeout,
 		},
 	}
 )
@@ -35,8 +37,19 @@ type API interface {
 	PostFileRequest(path string, fileData []byte, timeout int) error
 }
 
+// StatusError is returned when a server responds with an error status code.
+type StatusError struct {
+	Endpoint   string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("endpoint=%v,  statusCode=%v", e.Endpoint, e.StatusCode)
+}
+
 type api struct {
 	baseURL string
+	timeout int
 }
 
 var _ API = (*api)(nil)
@@ -59,7 +72,7 @@ func (ap *api) GetRequest(path string, timeout int) ([]byte, error) {
 	}
 	defer response.Body.Close()
 	if response.StatusCode >= 300 {
-		return nil, fmt.Errorf("GetRequest: endpoint=%v,  statusCode=%v", url, response.StatusCode)
+		return nil, fmt.Errorf("GetRequest: %w", &StatusError{Endpoint: url, StatusCode: response.StatusCode})
 	}
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -81,7 +94,7 @@ func (ap *api) DeleteRequest(path string, timeout int) ([]byte, error) {
 	}
 	defer response.Body.Close()
 	if response.StatusCode >= 300 {
-		return nil, fmt.Errorf("GetRequest: endpoint=%v,  statusCode=%v", url, response.StatusCode)
+		return nil, fmt.Errorf("GetRequest: %w", &StatusError{Endpoint: url, StatusCode: response.StatusCode})
 	}
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -113,7 +126,7 @@ func (ap *api) PostRequest(path string, contentType string, reqBody interface{},
 	}
 	defer response.Body.Close()
 	if response.StatusCode >= 300 {
-		return nil, fmt.Errorf("PostRequest: endpoint=%v,  statusCode=%v", url, response.StatusCode)
+		return nil, fmt.Errorf("PostRequest: %w", &StatusError{Endpoint: url, StatusCode: response.StatusCode})
 	}
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -149,7 +162,7 @@ func (ap *api) PostRequestAddOption(path string, contentType string, option stri
 	}
 	defer response.Body.Close()
 	if response.StatusCode >= 300 {
-		return nil, fmt.Errorf("PostRequest: endpoint=%v,  statusCode=%v", url, response.StatusCode)
+		return nil, fmt.Errorf("PostRequest: %w", &StatusError{Endpoint: url, StatusCode: response.StatusCode})
 	}
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -181,7 +194,7 @@ func (ap *api) PutRequest(path string, contentType string, reqBody interface{},
 	}
 	defer response.Body.Close()
 	if response.StatusCode >= 300 {
-		return nil, fmt.Errorf("PutRequest: endpoint=%v,  statusCode=%v", url, response.StatusCode)
+		return nil, fmt.Errorf("PutRequest: %w", &StatusError{Endpoint: url, StatusCode: response.StatusCode})
 	}
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -218,5 +231,8 @@ func (ap *api) PostFileRequest(path string, fileData []byte, timeout int) error
 		return fmt.Errorf("PostFileRequest: response=%v", response)
 	}
 	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("PostFileRequest: %w", &StatusError{Endpoint: url, StatusCode: response.StatusCode})
+	}
 	return nil
 }
@@ -1,28 +1,42 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"path/filepath"
 
+	"github.com/nttcom/ksot/nb-server/pkg/config"
 	"github.com/nttcom/ksot/nb-server/pkg/model"
 	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
 	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
 )
 
+// WRITE_ORDER_KEY is the reserved key of ref.json under which the services of the device are stored
+// from the oldest writer to the latest.
+const WRITE_ORDER_KEY = "@writeOrder"
+
 type GithubApiInterface interface {
 	API
 	PostFilesForBytes(byteMap map[string][]byte) error
 	UpdateFilesForBytes(byteMap map[string][]byte) error
+	UpdateFilesWithMessages(byteMap map[string][]byte, messages map[string]string) error
 	InitializeFilesForBytes(byteMap map[string][]byte) error
 	GetDeviceConfigs([]string) (map[string]orderedmap.OrderedmapInterfaces, error)
 	GetServices(services []string) (map[string]orderedmap.OrderedmapInterfaces, error)
 	GetServiceRefs([]string) (map[string]map[string]pathmap.PathMapInterface, error)
 	GetDevices(services []string) (map[string]orderedmap.OrderedmapInterfaces, error)
+	GetDeviceActuals(devices []string) (map[string]orderedmap.OrderedmapInterfaces, error)
+	GetConfigAt(path string, ref string) (orderedmap.OrderedmapInterfaces, error)
 	GetDeviceRefs([]string) (map[string]map[string]pathmap.PathMapInterface, error)
+	// GetDeviceRefsWithWriteOrders returns GetDeviceRefs with the write order of the services of every device.
+	GetDeviceRefsWithWriteOrders([]string) (map[string]map[string]pathmap.PathMapInterface, map[string][]string, error)
 	DeleteServices(serviceNames []string) error
+	ListDirectory(path string) ([]model.DirEntry, error)
 	MakePathForDeviceRef(string) string
 	MakePathForDeviceActual(string) string
+	MakePathForDeviceRemediated(string) string
 	MakePathForDeviceSet(string) string
 	MakePathForServiceInput(string) string
 	MakePathForServiceOutput(string) string
@@ -38,6 +52,7 @@ func NewGithubApi(url string) *githubAPI {
 	return &githubAPI{
 		&api{
 			baseURL: url,
+			timeout: config.Cfg.APITimeout,
 		},
 	}
 }
@@ -84,16 +99,23 @@ func (ga *githubAPI) GetService(serviceName string) (map[string]orderedmap.Order
 */
 
 func (ga *githubAPI) UpdateFilesForBytes(byteMap map[string][]byte) error {
+	return ga.UpdateFilesWithMessages(byteMap, nil)
+}
+
+// UpdateFilesWithMessages updates the files of byteMap. A file in messages is committed with its message
+// and the other files with their path.
+func (ga *githubAPI) UpdateFilesWithMessages(byteMap map[string][]byte, messages map[string]string) error {
 	for fp, bv := range byteMap {
 		reqToGitServer := model.ServiceReqToGitServer{
-			Path:       fp,
-			StringData: string(bv),
+			Path:          fp,
+			StringData:    string(bv),
+			CommitMessage: messages[fp],
 		}
 		reqToGitServerByte, err := json.Marshal(reqToGitServer)
 		if err != nil {
 			return err
 		}
-		_, err = ga.PostRequestAddOption("/file", "application/json", "update", reqToGitServerByte, 300)
+		_, err = ga.PostRequestAddOption("/file", "application/json", "update", reqToGitServerByte, ga.timeout)
 		if err != nil {
 			return err
 		}
@@ -111,7 +133,7 @@ func (ga *githubAPI) InitializeFilesForBytes(byteMap map[string][]byte) error {
 		if err != nil {
 			return err
 		}
-		_, err = ga.PostRequestAddOption("/file", "application/json", "new_safe", reqToGitServerByte, 300)
+		_, err = ga.PostRequestAddOption("/file", "application/json", "new_safe", reqToGitServerByte, ga.timeout)
 		if err != nil {
 			return err
 		}
@@ -129,7 +151,7 @@ func (ga *githubAPI) PostFilesForBytes(byteMap map[string][]byte) error {
 		if err != nil {
 			return err
 		}
-		_, err = ga.PostRequestAddOption("/file", "application/json", "new", reqToGitServerByte, 300)
+		_, err = ga.PostRequestAddOption("/file", "application/json", "new", reqToGitServerByte, ga.timeout)
 		if err != nil {
 			return err
 		}
@@ -141,7 +163,7 @@ func (ga *githubAPI) GetDeviceConfigs(devices []string) (map[string]orderedmap.O
 	result := make(map[string]orderedmap.OrderedmapInterfaces)
 	for _, v := range devices {
 		url := fmt.Sprintf("/file?path=%v", ga.MakePathForDeviceSet(v))
-		res, err := ga.GetRequest(url, 300)
+		res, err := ga.GetRequest(url, ga.timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -159,35 +181,65 @@ func (ga *githubAPI) GetDeviceConfigs(devices []string) (map[string]orderedmap.O
 }
 
 func (ga *githubAPI) GetDeviceRefs(devices []string) (map[string]map[string]pathmap.PathMapInterface, error) {
+	result, _, err := ga.GetDeviceRefsWithWriteOrders(devices)
+	return result, err
+}
+
+func (ga *githubAPI) GetDeviceRefsWithWriteOrders(devices []string) (map[string]map[string]pathmap.PathMapInterface, map[string][]string, error) {
 	result := make(map[string]map[string]pathmap.PathMapInterface)
+	writeOrders := make(map[string][]string)
 	for _, deviceName := range devices {
 		result[deviceName] = make(map[string]pathmap.PathMapInterface)
 		url := fmt.Sprintf("/file?path=%v", ga.MakePathForDeviceRef(deviceName))
-		res, err := ga.GetRequest(url, 300)
+		res, err := ga.GetRequest(url, ga.timeout)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		var resBody model.ServiceAllResFromGitServer
 		if err := json.Unmarshal(res, &resBody); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		mapValue := make(map[string]any)
-		err = json.Unmarshal([]byte(resBody.StringData), &mapValue)
+		err = unmarshalPathmaps([]byte(resBody.StringData), &mapValue)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		for serviceName, pmv := range mapValue {
+			if serviceName == WRITE_ORDER_KEY {
+				order, err := decodeWriteOrder(pmv)
+				if err != nil {
+					return nil, nil, err
+				}
+				writeOrders[deviceName] = order
+				continue
+			}
 			mpi, ok := pmv.(map[string]any)
 			if !ok {
-				return nil, fmt.Errorf("noexpected testdata")
+				return nil, nil, fmt.Errorf("noexpected testdata")
 			}
 			vpathmap, err := pathmap.NewPathMap(mpi)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			result[deviceName][serviceName] = vpathmap
 		}
 	}
+	return result, writeOrders, nil
+}
+
+func decodeWriteOrder(v any) ([]string, error) {
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("decodeWriteOrder: noexpected %v %v", WRITE_ORDER_KEY, v)
+	}
+	result := make([]string, 0, len(list))
+	for _, elm := range list {
+		serviceName, ok := elm.(string)
+		if !ok {
+			return nil, fmt.Errorf("decodeWriteOrder: noexpected %v %v", WRITE_ORDER_KEY, v)
+		}
+		result = append(result, serviceName)
+	}
 	return result, nil
 }
 
@@ -195,7 +247,7 @@ func (ga *githubAPI) GetServices(services []string) (map[string]orderedmap.Order
 	result := make(map[string]orderedmap.OrderedmapInterfaces)
 	for _, v := range services {
 		url := fmt.Sprintf("/file?path=%v", ga.MakePathForServiceInput(v))
-		res, err := ga.GetRequest(url, 300)
+		res, err := ga.GetRequest(url, ga.timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -217,7 +269,7 @@ func (ga *githubAPI) GetServiceRefs(services []string) (map[string]map[string]pa
 	for _, serviceName := range services {
 		result[serviceName] = make(map[string]pathmap.PathMapInterface)
 		url := fmt.Sprintf("/file?path=%v", ga.MakePathForServiceOutput(serviceName))
-		res, err := ga.GetRequest(url, 300)
+		res, err := ga.GetRequest(url, ga.timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -226,7 +278,7 @@ func (ga *githubAPI) GetServiceRefs(services []string) (map[string]map[string]pa
 			return nil, err
 		}
 		mapValue := make(map[string]any)
-		err = json.Unmarshal([]byte(resBody.StringData), &mapValue)
+		err = unmarshalPathmaps([]byte(resBody.StringData), &mapValue)
 		if err != nil {
 			return nil, err
 		}
@@ -249,7 +301,29 @@ func (ga *githubAPI) GetDevices(devices []string) (map[string]orderedmap.Ordered
 	result := make(map[string]orderedmap.OrderedmapInterfaces)
 	for _, v := range devices {
 		url := fmt.Sprintf("/file?path=%v", ga.MakePathForDeviceSet(v))
-		res, err := ga.GetRequest(url, 300)
+		res, err := ga.GetRequest(url, ga.timeout)
+		if err != nil {
+			return nil, err
+		}
+		var resBody model.ServiceAllResFromGitServer
+		if err := json.Unmarshal(res, &resBody); err != nil {
+			return nil, err
+		}
+		mapValue, err := orderedmap.New([]byte(resBody.StringData))
+		if err != nil {
+			return nil, err
+		}
+		result[v] = mapValue
+	}
+	return result, nil
+}
+
+// GetDeviceActuals returns the running configs of the devices stored by the last sync (actual.json).
+func (ga *githubAPI) GetDeviceActuals(devices []string) (map[string]orderedmap.OrderedmapInterfaces, error) {
+	result := make(map[string]orderedmap.OrderedmapInterfaces)
+	for _, v := range devices {
+		url := fmt.Sprintf("/file?path=%v", ga.MakePathForDeviceActual(v))
+		res, err := ga.GetRequest(url, ga.timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -266,6 +340,23 @@ func (ga *githubAPI) GetDevices(devices []string) (map[string]orderedmap.Ordered
 	return result, nil
 }
 
+// GetConfigAt returns the JSON file at path as it was at the git revision ref, or as it is now if ref is empty.
+func (ga *githubAPI) GetConfigAt(path string, ref string) (orderedmap.OrderedmapInterfaces, error) {
+	query := "/file?path=" + url.QueryEscape(path)
+	if ref != "" {
+		query += "&ref=" + url.QueryEscape(ref)
+	}
+	res, err := ga.GetRequest(query, ga.timeout)
+	if err != nil {
+		return nil, err
+	}
+	var resBody model.ServiceAllResFromGitServer
+	if err := json.Unmarshal(res, &resBody); err != nil {
+		return nil, err
+	}
+	return orderedmap.New([]byte(resBody.StringData))
+}
+
 func (ga *githubAPI) DeleteServices(serviceNames []string) error {
 	deleteQuery := ""
 	if len(serviceNames) == 1 {
@@ -278,13 +369,25 @@ func (ga *githubAPI) DeleteServices(serviceNames []string) error {
 			}
 		}
 	}
-	_, err := ga.DeleteRequest("/file"+deleteQuery, 300)
+	_, err := ga.DeleteRequest("/file"+deleteQuery, ga.timeout)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (ga *githubAPI) ListDirectory(path string) ([]model.DirEntry, error) {
+	res, err := ga.GetRequest("/dir?path="+url.QueryEscape(path), ga.timeout)
+	if err != nil {
+		return nil, err
+	}
+	var resBody model.DirResFromGitServer
+	if err := json.Unmarshal(res, &resBody); err != nil {
+		return nil, err
+	}
+	return resBody.Entries, nil
+}
+
 func (ga *githubAPI) MakePathForDeviceRef(name string) string {
 	return filepath.Clean(fmt.Sprintf("/Devices/%v/ref.json", name))
 }
@@ -300,3 +403,13 @@ func (ga *githubAPI) MakePathForServiceOutput(name string) string {
 func (ga *githubAPI) MakePathForDeviceActual(name string) string {
 	return filepath.Clean(fmt.Sprintf("/Devices/%v/actual.json", name))
 }
+func (ga *githubAPI) MakePathForDeviceRemediated(name string) string {
+	return filepath.Clean(fmt.Sprintf("/Devices/%v/remediated.json", name))
+}
+
+// unmarshalPathmaps decodes numbers as json.Number so that int64, uint64 and decimal64 values are kept exactly.
+func unmarshalPathmaps(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
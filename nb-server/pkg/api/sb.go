@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/nttcom/ksot/nb-server/pkg/config"
 	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
 )
 
@@ -24,12 +25,13 @@ func NewSbApi(url string) *sbAPI {
 	return &sbAPI{
 		&api{
 			baseURL: url,
+			timeout: config.Cfg.APITimeout,
 		},
 	}
 }
 
 func (sb *sbAPI) GetDevice(name string) (orderedmap.OrderedmapInterfaces, error) {
-	res, err := sb.GetRequest("/devices/"+name, 300)
+	res, err := sb.GetRequest("/devices/"+name, sb.timeout)
 	if err != nil {
 		return nil, fmt.Errorf("GetDevice: %w", err)
 	}
@@ -41,12 +43,12 @@ func (sb *sbAPI) GetDevice(name string) (orderedmap.OrderedmapInterfaces, error)
 }
 
 func (sb *sbAPI) SetDevice(name string, setConfig interface{}) ([]byte, error) {
-	return sb.PostRequest("/devices/"+name, "application/json", setConfig, 300)
+	return sb.PostRequest("/devices/"+name, "application/json", setConfig, sb.timeout)
 }
 
 func (sb *sbAPI) GetDeviceInfos() (map[string]string, error) {
 	result := make(map[string]string)
-	res, err := sb.GetRequest("/devices", 300)
+	res, err := sb.GetRequest("/devices", sb.timeout)
 	if err != nil {
 		return nil, fmt.Errorf("GetDeviceNames: %w", err)
 	}
@@ -0,0 +1,131 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	CODE_INVALID_REQUEST        = "invalid-request"
+	CODE_UNSUPPORTED_MEDIA_TYPE = "unsupported-media-type"
+	CODE_NOT_FOUND              = "not-found"
+	CODE_CONFLICT               = "conflict"
+	CODE_VALIDATION_FAILED      = "validation-failed"
+	CODE_TF_LOGIC_NOT_FOUND     = "tf-logic-not-found"
+	CODE_TF_LOGIC_FAILED        = "tf-logic-failed"
+	CODE_COMPOSITE_CONFLICT     = "composite-conflict"
+	CODE_DEVICE_NOT_SYNCED      = "device-not-synced"
+	CODE_OUT_OF_BAND_CONFLICT   = "out-of-band-conflict"
+	CODE_UNMANAGED_CONFIG       = "unmanaged-config"
+	CODE_UNSUPPORTED_INTERFACE  = "unsupported-interface"
+	CODE_SB_UNAVAILABLE         = "sb-unavailable"
+	CODE_GIT_FAILED             = "git-failed"
+	CODE_CONFIGURE_FAILED       = "configure-failed"
+	CODE_ROLLBACK_FAILED        = "rollback-failed"
+	CODE_INTERNAL               = "internal"
+)
+
+var statusCodes = map[string]int{
+	CODE_INVALID_REQUEST:        http.StatusBadRequest,
+	CODE_UNSUPPORTED_MEDIA_TYPE: http.StatusUnsupportedMediaType,
+	CODE_NOT_FOUND:              http.StatusNotFound,
+	CODE_CONFLICT:               http.StatusConflict,
+	CODE_VALIDATION_FAILED:      http.StatusUnprocessableEntity,
+	CODE_TF_LOGIC_NOT_FOUND:     http.StatusUnprocessableEntity,
+	CODE_TF_LOGIC_FAILED:        http.StatusUnprocessableEntity,
+	CODE_COMPOSITE_CONFLICT:     http.StatusConflict,
+	CODE_DEVICE_NOT_SYNCED:      http.StatusConflict,
+	CODE_OUT_OF_BAND_CONFLICT:   http.StatusConflict,
+	CODE_UNMANAGED_CONFIG:       http.StatusConflict,
+	CODE_UNSUPPORTED_INTERFACE:  http.StatusNotImplemented,
+	CODE_SB_UNAVAILABLE:         http.StatusBadGateway,
+	CODE_GIT_FAILED:             http.StatusBadGateway,
+	CODE_CONFIGURE_FAILED:       http.StatusBadGateway,
+	CODE_ROLLBACK_FAILED:        http.StatusInternalServerError,
+	CODE_INTERNAL:               http.StatusInternalServerError,
+}
+
+// Rollback tells whether the devices configured before a failure were restored.
+type Rollback struct {
+	Attempted         bool     `json:"attempted"`
+	Succeeded         bool     `json:"succeeded"`
+	RolledBackDevices []string `json:"rolledBackDevices"`
+	FailedDevices     []string `json:"failedDevices"`
+}
+
+// Error is the error returned to clients of nb-server.
+type Error struct {
+	Code     string    `json:"code"`
+	Phase    string    `json:"phase,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	Service  string    `json:"service,omitempty"`
+	Message  string    `json:"message"`
+	Rollback *Rollback `json:"rollback,omitempty"`
+	// Details is additional information of the code such as the list of conflicts.
+	Details any `json:"details,omitempty"`
+	cause   error
+}
+
+func New(code string, format string, a ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// Wrap returns err as an Error with code. If err already contains an Error, its code and fields are kept
+// and only the message is extended by the wrapping context.
+func Wrap(code string, err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		result := *apiErr
+		result.Message = err.Error()
+		result.cause = err
+		return &result
+	}
+	return &Error{Code: code, Message: err.Error(), cause: err}
+}
+
+// From returns err as an Error. Errors without a code are internal errors.
+func From(err error) *Error {
+	return Wrap(CODE_INTERNAL, err)
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// StatusCode returns the HTTP status code of the error.
+func (e *Error) StatusCode() int {
+	if v, ok := statusCodes[e.Code]; ok {
+		return v
+	}
+	return http.StatusInternalServerError
+}
+
+func (e *Error) WithPhase(phase string) *Error {
+	e.Phase = phase
+	return e
+}
+
+func (e *Error) WithDevice(deviceName string) *Error {
+	e.Device = deviceName
+	return e
+}
+
+func (e *Error) WithService(serviceName string) *Error {
+	e.Service = serviceName
+	return e
+}
+
+func (e *Error) WithDetails(details any) *Error {
+	e.Details = details
+	return e
+}
+
+func (e *Error) WithRollback(rollback *Rollback) *Error {
+	e.Rollback = rollback
+	return e
+}
@@ -0,0 +1,51 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		code        string
+		err         error
+		wantCode    string
+		wantStatus  int
+		wantMessage string
+		wantDevice  string
+	}
+	tests := map[string]test{
+		"正常系: コードなしのエラー": {
+			code:        CODE_GIT_FAILED,
+			err:         errors.New("push failed"),
+			wantCode:    CODE_GIT_FAILED,
+			wantStatus:  http.StatusBadGateway,
+			wantMessage: "push failed",
+		},
+		"正常系: ラップされたErrorのコードを維持": {
+			code:        CODE_INTERNAL,
+			err:         fmt.Errorf("makePlan: %w", New(CODE_VALIDATION_FAILED, "invalid %v", "deviceA").WithDevice("deviceA")),
+			wantCode:    CODE_VALIDATION_FAILED,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantMessage: "makePlan: invalid deviceA",
+			wantDevice:  "deviceA",
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := Wrap(tt.code, tt.err)
+			assert.Equal(t, tt.wantCode, got.Code)
+			assert.Equal(t, tt.wantStatus, got.StatusCode())
+			assert.Equal(t, tt.wantMessage, got.Error())
+			assert.Equal(t, tt.wantDevice, got.Device)
+			assert.True(t, errors.Is(got, tt.err))
+		})
+	}
+}
@@ -1,17 +1,37 @@
 package composite
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"golang.org/x/exp/maps"
 )
 
 type CompositeInterface interface {
 	CompositePathmaps(map[string]map[string]pathmap.PathMapInterface) (map[string]pathmap.PathMapInterface, error)
+	CompositePathmapsWithResolutions(map[string]map[string]pathmap.PathMapInterface, Options) (map[string]pathmap.PathMapInterface, []pathmap.Resolution, error)
 	CompositeAndUpdateAndReplaceKeyPathmaps(map[string]map[string]pathmap.PathMapInterface, map[string]map[string]pathmap.PathMapInterface) (map[string]pathmap.PathMapInterface, error)
 	UpdateDeviceRefForComposite(serviceDeviceToPathmap map[string]map[string]pathmap.PathMapInterface, oldDeviceServiceToPathmap map[string]map[string]pathmap.PathMapInterface) (map[string]map[string]pathmap.PathMapInterface, error)
 }
 
+// Options controls how the values of different services to the same leaf are resolved.
+type Options struct {
+	// ServiceOptions are the default pathmap options of every value of a service, overridden by the options of a path.
+	ServiceOptions map[string]map[string]string
+	// LatestServices are the last writers, such as the services of the running transaction.
+	// The other services are ordered by WriteOrders.
+	LatestServices []string
+	// WriteOrders are the services of each device from the oldest writer to the latest, as stored in ref.json.
+	WriteOrders map[string][]string
+	// ListKeys are the keys of the lists of the device models by device. A list not in ListKeys is keyed
+	// by the key predicates in the paths of the pathmaps of the device.
+	ListKeys map[string]yangpath.ListKeys
+}
+
 type Composite struct{}
 
 var _ CompositeInterface = (*Composite)(nil)
@@ -20,6 +40,8 @@ func NewCompositeInterface() CompositeInterface {
 	return &Composite{}
 }
 
+// UpdateDeviceRefForComposite returns the ref.json of each device of serviceDeviceToPathmap with the pathmaps of its services
+// replaced. oldDeviceServiceToPathmap is not changed, so that it still tells the owners before the change.
 func (c *Composite) UpdateDeviceRefForComposite(serviceDeviceToPathmap map[string]map[string]pathmap.PathMapInterface, oldDeviceServiceToPathmap map[string]map[string]pathmap.PathMapInterface) (map[string]map[string]pathmap.PathMapInterface, error) {
 	deviceServiceToPathmap := make(map[string]map[string]pathmap.PathMapInterface)
 	for serviceName, deviceToPathmap := range serviceDeviceToPathmap {
@@ -29,7 +51,7 @@ func (c *Composite) UpdateDeviceRefForComposite(serviceDeviceToPathmap map[strin
 				if !checkSync {
 					return nil, fmt.Errorf("updateAndReplaceKey: not found device %v ref, run sync", deviceName)
 				}
-				deviceServiceToPathmap[deviceName] = oldPathmapValue
+				deviceServiceToPathmap[deviceName] = maps.Clone(oldPathmapValue)
 			}
 			deviceServiceToPathmap[deviceName][serviceName] = v
 		}
@@ -38,21 +60,181 @@ func (c *Composite) UpdateDeviceRefForComposite(serviceDeviceToPathmap map[strin
 }
 
 func (c *Composite) CompositePathmaps(deviceServiceToPathmap map[string]map[string]pathmap.PathMapInterface) (map[string]pathmap.PathMapInterface, error) {
+	deviceToPathmap, _, err := c.CompositePathmapsWithResolutions(deviceServiceToPathmap, Options{})
+	if err != nil {
+		return nil, fmt.Errorf("CompositePathmaps: %w", err)
+	}
+	return deviceToPathmap, nil
+}
+
+// CompositePathmapsWithResolutions composes the pathmaps of every service on each device leaf by leaf
+// and returns the winner of each leaf contested under a conflict policy. Every composed leaf carries its Provenance.
+// The conflicts that cannot be resolved on all devices are returned together as a *pathmap.ConflictError.
+func (c *Composite) CompositePathmapsWithResolutions(deviceServiceToPathmap map[string]map[string]pathmap.PathMapInterface, opts Options) (map[string]pathmap.PathMapInterface, []pathmap.Resolution, error) {
 	deviceToPathmap := make(map[string]pathmap.PathMapInterface)
-	for deviceName, serviceToPathmap := range deviceServiceToPathmap {
+	resolutions := make([]pathmap.Resolution, 0)
+	conflicts := make([]pathmap.Conflict, 0)
+	deviceNames := maps.Keys(deviceServiceToPathmap)
+	sort.Strings(deviceNames)
+	for _, deviceName := range deviceNames {
+		serviceToPathmap := deviceServiceToPathmap[deviceName]
+		contributions := make(map[string][]pathmap.Contribution)
+		listKeys, err := pathmap.LearnListKeys(opts.ListKeys[deviceName], maps.Values(serviceToPathmap)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CompositePathmaps: %w", err)
+		}
+		for _, serviceName := range ServiceOrder(maps.Keys(serviceToPathmap), opts.WriteOrders[deviceName], opts.LatestServices) {
+			leaves, err := pathmap.ExpandLeavesWithKeys(serviceToPathmap[serviceName], listKeys)
+			if err != nil {
+				return nil, nil, fmt.Errorf("CompositePathmaps: %w", err)
+			}
+			for _, path := range leaves.GetKeys() {
+				value, _ := leaves.GetValue(path)
+				option, _ := leaves.GetOption(path)
+				contributions[path] = append(contributions[path], pathmap.Contribution{
+					Service: serviceName,
+					Value:   value,
+					Option:  withDefaultOptions(opts.ServiceOptions[serviceName], option),
+				})
+			}
+		}
 		setPathmap, err := pathmap.NewPathMap(make(map[string]any))
 		if err != nil {
-			return nil, fmt.Errorf("CompositePathmaps: %w", err)
+			return nil, nil, fmt.Errorf("CompositePathmaps: %w", err)
 		}
-		deviceToPathmap[deviceName] = setPathmap
-		for _, vmap := range serviceToPathmap {
-			err := deviceToPathmap[deviceName].Composite([]pathmap.PathMapInterface{vmap})
+		paths := maps.Keys(contributions)
+		sort.Strings(paths)
+		for _, v := range exclusiveConflicts(paths, contributions) {
+			v.Device = deviceName
+			conflicts = append(conflicts, v)
+		}
+		for _, path := range paths {
+			value, resolution, err := pathmap.Resolve(path, contributions[path])
+			var conflictErr *pathmap.ConflictError
+			if errors.As(err, &conflictErr) {
+				for _, v := range conflictErr.Conflicts {
+					v.Device = deviceName
+					conflicts = append(conflicts, v)
+				}
+				continue
+			}
 			if err != nil {
-				return nil, fmt.Errorf("CompositePathmaps: %w", err)
+				return nil, nil, fmt.Errorf("CompositePathmaps: %v: %w", deviceName, err)
+			}
+			option := contributions[path][0].Option
+			if resolution != nil {
+				resolution.Device = deviceName
+				resolutions = append(resolutions, *resolution)
+				for _, v := range contributions[path] {
+					if v.Service == resolution.Winner {
+						option = v.Option
+					}
+				}
+			}
+			if err := setPathmap.SetValue(path, value, option); err != nil {
+				return nil, nil, fmt.Errorf("CompositePathmaps: %w", err)
+			}
+			if err := setPathmap.SetProvenance(path, pathmap.NewProvenance(value, contributions[path])); err != nil {
+				return nil, nil, fmt.Errorf("CompositePathmaps: %w", err)
 			}
 		}
+		deviceToPathmap[deviceName] = setPathmap
 	}
-	return deviceToPathmap, nil
+	if len(conflicts) != 0 {
+		return nil, nil, &pathmap.ConflictError{Conflicts: conflicts}
+	}
+	return deviceToPathmap, resolutions, nil
+}
+
+// exclusiveConflicts returns a conflict for every path under an exclusive, replaced or deleted path of a service
+// that is set by another service. The paths must be sorted so that the paths under a path follow it.
+func exclusiveConflicts(paths []string, contributions map[string][]pathmap.Contribution) []pathmap.Conflict {
+	conflicts := make([]pathmap.Conflict, 0)
+	for i, path := range paths {
+		for j, c := range contributions[path] {
+			if !pathmap.IsExclusive(c.Option) {
+				continue
+			}
+			// the same path set by the other services is reported once by its first owner
+			if c.Option[pathmap.OPTION_OWNER] == pathmap.OWNER_EXCLUSIVE && !hasExclusiveOwner(contributions[path][:j]) {
+				for _, v := range contributions[path] {
+					if v.Service != c.Service {
+						conflicts = append(conflicts, exclusiveConflict(path, c, v))
+					}
+				}
+			}
+			for _, subPath := range paths[i+1:] {
+				if !strings.HasPrefix(subPath, path) {
+					break
+				}
+				if !yangpath.IsDescendant(subPath, path) {
+					continue
+				}
+				for _, v := range contributions[subPath] {
+					if v.Service != c.Service {
+						conflicts = append(conflicts, exclusiveConflict(subPath, c, v))
+					}
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+func exclusiveConflict(path string, owner pathmap.Contribution, other pathmap.Contribution) pathmap.Conflict {
+	return pathmap.Conflict{
+		Path:     path,
+		Values:   []any{owner.Value, other.Value},
+		Services: []string{owner.Service, other.Service},
+		Reason:   fmt.Sprintf("set under the %v path of %v", exclusiveReason(owner.Option), owner.Service),
+	}
+}
+
+func hasExclusiveOwner(contributions []pathmap.Contribution) bool {
+	for _, v := range contributions {
+		if v.Option[pathmap.OPTION_OWNER] == pathmap.OWNER_EXCLUSIVE {
+			return true
+		}
+	}
+	return false
+}
+
+func exclusiveReason(option map[string]string) string {
+	switch {
+	case option[pathmap.OPTION_OWNER] == pathmap.OWNER_EXCLUSIVE:
+		return "exclusive"
+	case pathmap.Operation(option) == pathmap.OPERATION_DELETE:
+		return "deleted"
+	default:
+		return "replaced"
+	}
+}
+
+// ServiceOrder orders serviceNames from the oldest writer to the latest: the services not in writeOrder by name,
+// the services in writeOrder in its order, and then latestServices by name.
+func ServiceOrder(serviceNames []string, writeOrder []string, latestServices []string) []string {
+	rank := make(map[string]int)
+	for i, v := range writeOrder {
+		rank[v] = i + 1
+	}
+	for _, v := range latestServices {
+		rank[v] = len(writeOrder) + 1
+	}
+	result := append(make([]string, 0, len(serviceNames)), serviceNames...)
+	sort.Slice(result, func(i, j int) bool {
+		if rank[result[i]] != rank[result[j]] {
+			return rank[result[i]] < rank[result[j]]
+		}
+		return result[i] < result[j]
+	})
+	return result
+}
+
+func withDefaultOptions(defaults map[string]string, option map[string]string) map[string]string {
+	result := make(map[string]string)
+	maps.Copy(result, defaults)
+	maps.Copy(result, option)
+	return result
 }
 
 func (c *Composite) CompositeAndUpdateAndReplaceKeyPathmaps(serviceDeviceToPathmap map[string]map[string]pathmap.PathMapInterface, oldDeviceServiceToPathmap map[string]map[string]pathmap.PathMapInterface) (map[string]pathmap.PathMapInterface, error) {
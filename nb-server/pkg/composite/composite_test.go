@@ -1,8 +1,10 @@
 package composite
 
 import (
+	"errors"
 	"testing"
 
+	iomap "github.com/iancoleman/orderedmap"
 	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
 	"github.com/stretchr/testify/assert"
 )
@@ -34,23 +36,25 @@ var (
 			},
 		},
 	}
+	ownedByA            = &pathmap.Provenance{Services: []string{"serviceA"}}
+	ownedByB            = &pathmap.Provenance{Services: []string{"serviceB"}, Elements: map[string][]string{"a": {"serviceB"}, "b": {"serviceB"}, "c": {"serviceB"}}}
 	wantDeviceToPathmap = []map[string]pathmap.PathMapInterface{
 		{
-			"deviceA": pathmap.PathMap{
+			"deviceA": withProvenance(pathmap.PathMap{
 				"/string":        pathmap.NewPathMapValueSafe([]string{"string"}, "update_a", make(map[string]string)),
 				"/bool":          pathmap.NewPathMapValueSafe([]string{"bool"}, true, make(map[string]string)),
 				"/num":           pathmap.NewPathMapValueSafe([]string{"num"}, 100, make(map[string]string)),
 				"/string_list_B": pathmap.NewPathMapValueSafe([]string{"string_list_B"}, []string{"a", "b", "c"}, make(map[string]string)),
-			},
+			}, map[string]*pathmap.Provenance{"/string": ownedByA, "/bool": ownedByA, "/num": ownedByA, "/string_list_B": ownedByB}),
 		},
 	}
 	wantDeviceToOldPathmap = []map[string]pathmap.PathMapInterface{
 		{
-			"deviceA": pathmap.PathMap{
+			"deviceA": withProvenance(pathmap.PathMap{
 				"/string":        pathmap.NewPathMapValueSafe([]string{"string"}, "a", make(map[string]string)),
 				"/bool":          pathmap.NewPathMapValueSafe([]string{"bool"}, true, make(map[string]string)),
 				"/string_list_B": pathmap.NewPathMapValueSafe([]string{"string_list_B"}, []string{"a", "b", "c"}, make(map[string]string)),
-			},
+			}, map[string]*pathmap.Provenance{"/string": ownedByA, "/bool": ownedByA, "/string_list_B": ownedByB}),
 		},
 	}
 	compositePathMapWantsErrs = []error{
@@ -58,6 +62,13 @@ var (
 	}
 )
 
+func withProvenance(pm pathmap.PathMap, provenances map[string]*pathmap.Provenance) pathmap.PathMap {
+	for k, v := range provenances {
+		_ = pm.SetProvenance(k, v)
+	}
+	return pm
+}
+
 func TestCompositPathmaps(t *testing.T) {
 	t.Parallel()
 	type test struct {
@@ -113,3 +124,289 @@ func TestCompositeAndUpdateAndReplaceKeyPathmaps(t *testing.T) {
 		})
 	}
 }
+
+func TestCompositePathmapsWithResolutions(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		serviceOptions map[string]map[string]string
+		pathOption     map[string]string
+		latest         []string
+		writeOrder     []string
+		wantValue      any
+		wantWinner     string
+		wantErr        bool
+	}
+	tests := map[string]test{
+		"正常系: priority": {
+			serviceOptions: map[string]map[string]string{
+				"serviceA": {pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_PRIORITY, pathmap.OPTION_PRIORITY: "10"},
+				"serviceB": {pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_PRIORITY, pathmap.OPTION_PRIORITY: "1"},
+			},
+			pathOption: map[string]string{},
+			latest:     []string{"serviceB"},
+			wantValue:  "a",
+			wantWinner: "serviceA",
+		},
+		"正常系: pathのoptionでlast-writer-wins": {
+			serviceOptions: map[string]map[string]string{},
+			pathOption:     map[string]string{pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_LAST_WRITER_WINS},
+			latest:         []string{"serviceA"},
+			wantValue:      "a",
+			wantWinner:     "serviceA",
+		},
+		"正常系: 保存された書き込み順でlast-writer-wins": {
+			serviceOptions: map[string]map[string]string{},
+			pathOption:     map[string]string{pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_LAST_WRITER_WINS},
+			writeOrder:     []string{"serviceB", "serviceA"},
+			wantValue:      "a",
+			wantWinner:     "serviceA",
+		},
+		"正常系: 無関係なサービスの変更では勝者が変わらない": {
+			serviceOptions: map[string]map[string]string{},
+			pathOption:     map[string]string{pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_LAST_WRITER_WINS},
+			latest:         []string{"serviceC"},
+			writeOrder:     []string{"serviceB", "serviceA"},
+			wantValue:      "a",
+			wantWinner:     "serviceA",
+		},
+		"異常系: policyなし": {
+			serviceOptions: map[string]map[string]string{},
+			pathOption:     map[string]string{},
+			wantErr:        true,
+		},
+		"異常系: 同じpriority": {
+			serviceOptions: map[string]map[string]string{
+				"serviceA": {pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_PRIORITY},
+				"serviceB": {pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_PRIORITY},
+			},
+			pathOption: map[string]string{},
+			wantErr:    true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			arg := map[string]map[string]pathmap.PathMapInterface{
+				"deviceA": {
+					"serviceA": pathmap.PathMap{
+						"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "a", tt.pathOption),
+						"/bool":   pathmap.NewPathMapValueSafe([]string{"bool"}, true, make(map[string]string)),
+					},
+					"serviceB": pathmap.PathMap{
+						"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "b", tt.pathOption),
+					},
+				},
+			}
+			result, resolutions, err := testComposite.CompositePathmapsWithResolutions(arg, Options{
+				ServiceOptions: tt.serviceOptions,
+				LatestServices: tt.latest,
+				WriteOrders:    map[string][]string{"deviceA": tt.writeOrder},
+			})
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			value, _ := result["deviceA"].GetValue("/string")
+			assert.Equal(t, tt.wantValue, value)
+			assert.Equal(t, 1, len(resolutions))
+			assert.Equal(t, tt.wantWinner, resolutions[0].Winner)
+			assert.Equal(t, "deviceA", resolutions[0].Device)
+		})
+	}
+}
+
+func TestCompositePathmapsWithResolutionsForConflicts(t *testing.T) {
+	t.Parallel()
+	arg := map[string]map[string]pathmap.PathMapInterface{
+		"deviceA": {
+			"serviceA": pathmap.PathMap{
+				"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "a", make(map[string]string)),
+				"/num":    pathmap.NewPathMapValueSafe([]string{"num"}, 1, make(map[string]string)),
+			},
+			"serviceB": pathmap.PathMap{
+				"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "b", make(map[string]string)),
+				"/num":    pathmap.NewPathMapValueSafe([]string{"num"}, 2, make(map[string]string)),
+			},
+		},
+		"deviceB": {
+			"serviceA": pathmap.PathMap{
+				"/bool": pathmap.NewPathMapValueSafe([]string{"bool"}, true, make(map[string]string)),
+			},
+			"serviceC": pathmap.PathMap{
+				"/bool": pathmap.NewPathMapValueSafe([]string{"bool"}, false, make(map[string]string)),
+			},
+		},
+	}
+	_, _, err := testComposite.CompositePathmapsWithResolutions(arg, Options{})
+	var conflictErr *pathmap.ConflictError
+	assert.True(t, errors.As(err, &conflictErr))
+	assert.Equal(t, []pathmap.Conflict{
+		{Device: "deviceA", Path: "/num", Values: []any{1, 2}, Services: []string{"serviceA", "serviceB"}, Reason: "different values without a conflict policy"},
+		{Device: "deviceA", Path: "/string", Values: []any{"a", "b"}, Services: []string{"serviceA", "serviceB"}, Reason: "different values without a conflict policy"},
+		{Device: "deviceB", Path: "/bool", Values: []any{true, false}, Services: []string{"serviceA", "serviceC"}, Reason: "different values without a conflict policy"},
+	}, conflictErr.Conflicts)
+}
+
+func TestCompositePathmapsWithResolutionsForExclusive(t *testing.T) {
+	t.Parallel()
+	exclusive := map[string]string{pathmap.OPTION_OWNER: pathmap.OWNER_EXCLUSIVE}
+	replace := map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_REPLACE}
+	entry := iomap.New()
+	entry.Set("F", "f0")
+	type test struct {
+		arg  map[string]pathmap.PathMapInterface
+		want []pathmap.Conflict
+	}
+	tests := map[string]test{
+		"正常系: 排他パスを同じサービスが設定": {
+			arg: map[string]pathmap.PathMapInterface{
+				"serviceA": pathmap.PathMap{
+					"/A":   pathmap.NewPathMapValueSafe([]string{"A"}, "a", exclusive),
+					"/A/B": pathmap.NewPathMapValueSafe([]string{"A", "B"}, "b", make(map[string]string)),
+				},
+				"serviceB": pathmap.PathMap{
+					"/AB": pathmap.NewPathMapValueSafe([]string{"AB"}, "ab", make(map[string]string)),
+				},
+			},
+			want: nil,
+		},
+		"異常系: 排他パスを他サービスが設定": {
+			arg: map[string]pathmap.PathMapInterface{
+				"serviceA": pathmap.PathMap{
+					"/A": pathmap.NewPathMapValueSafe([]string{"A"}, "a", exclusive),
+				},
+				"serviceB": pathmap.PathMap{
+					"/A": pathmap.NewPathMapValueSafe([]string{"A"}, "a", make(map[string]string)),
+				},
+			},
+			want: []pathmap.Conflict{
+				{Device: "deviceA", Path: "/A", Values: []any{"a", "a"}, Services: []string{"serviceA", "serviceB"}, Reason: "set under the exclusive path of serviceA"},
+			},
+		},
+		"異常系: replaceしたパスの配下を他サービスが設定": {
+			arg: map[string]pathmap.PathMapInterface{
+				"serviceA": pathmap.PathMap{
+					"/A/E[F=f0]": pathmap.NewPathMapValueSafe([]string{"A", "E[F=f0]"}, *entry, replace),
+				},
+				"serviceB": pathmap.PathMap{
+					"/A/E[F=f0]/G": pathmap.NewPathMapValueSafe([]string{"A", "E[F=f0]", "G"}, "g", make(map[string]string)),
+				},
+			},
+			want: []pathmap.Conflict{
+				{Device: "deviceA", Path: "/A/E[F=f0]/G", Values: []any{*entry, "g"}, Services: []string{"serviceA", "serviceB"}, Reason: "set under the replaced path of serviceA"},
+			},
+		},
+		"異常系: 異なるoperation": {
+			arg: map[string]pathmap.PathMapInterface{
+				"serviceA": pathmap.PathMap{
+					"/A": pathmap.NewPathMapValueSafe([]string{"A"}, "a", map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_DELETE}),
+				},
+				"serviceB": pathmap.PathMap{
+					"/A": pathmap.NewPathMapValueSafe([]string{"A"}, "a", make(map[string]string)),
+				},
+			},
+			want: []pathmap.Conflict{
+				{Device: "deviceA", Path: "/A", Values: []any{"a", "a"}, Services: []string{"serviceA", "serviceB"}, Reason: "different operations"},
+			},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, _, err := testComposite.CompositePathmapsWithResolutions(map[string]map[string]pathmap.PathMapInterface{"deviceA": tt.arg}, Options{})
+			if tt.want == nil {
+				assert.Nil(t, err)
+				return
+			}
+			var conflictErr *pathmap.ConflictError
+			assert.True(t, errors.As(err, &conflictErr))
+			assert.Equal(t, tt.want, conflictErr.Conflicts)
+		})
+	}
+}
+
+func TestCompositePathmapsWithResolutionsForProvenance(t *testing.T) {
+	t.Parallel()
+	arg := map[string]map[string]pathmap.PathMapInterface{
+		"deviceA": {
+			"serviceA": pathmap.PathMap{
+				"/interfaces/interface[name=eth0]/mtu": pathmap.NewPathMapValueSafe([]string{"interfaces", "interface[name=eth0]", "mtu"}, 1500, make(map[string]string)),
+				"/vlans":                               pathmap.NewPathMapValueSafe([]string{"vlans"}, []int{10, 20}, make(map[string]string)),
+			},
+			"serviceB": pathmap.PathMap{
+				"/interfaces/interface[name=eth0]/mtu": pathmap.NewPathMapValueSafe([]string{"interfaces", "interface[name=eth0]", "mtu"}, 1500, make(map[string]string)),
+				"/vlans":                               pathmap.NewPathMapValueSafe([]string{"vlans"}, []int{20, 30}, make(map[string]string)),
+			},
+		},
+	}
+	result, _, err := testComposite.CompositePathmapsWithResolutions(arg, Options{})
+	assert.Nil(t, err)
+	provenance, ok := result["deviceA"].GetProvenance("/interfaces/interface[name=eth0]/mtu")
+	assert.True(t, ok)
+	assert.Equal(t, &pathmap.Provenance{Services: []string{"serviceA", "serviceB"}}, provenance)
+	provenance, ok = result["deviceA"].GetProvenance("/vlans")
+	assert.True(t, ok)
+	assert.Equal(t, &pathmap.Provenance{
+		Services: []string{"serviceA", "serviceB"},
+		Elements: map[string][]string{"10": {"serviceA"}, "20": {"serviceA", "serviceB"}, "30": {"serviceB"}},
+	}, provenance)
+}
+
+func TestServiceOrder(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		serviceNames []string
+		writeOrder   []string
+		latest       []string
+		want         []string
+	}
+	tests := map[string]test{
+		"正常系: 名前順": {
+			serviceNames: []string{"serviceB", "serviceA"},
+			want:         []string{"serviceA", "serviceB"},
+		},
+		"正常系: 書き込み順の前に未記録のサービス": {
+			serviceNames: []string{"serviceA", "serviceB", "serviceC"},
+			writeOrder:   []string{"serviceC", "serviceA"},
+			want:         []string{"serviceB", "serviceC", "serviceA"},
+		},
+		"正常系: 最新のサービスは最後": {
+			serviceNames: []string{"serviceA", "serviceB", "serviceC"},
+			writeOrder:   []string{"serviceC", "serviceB", "serviceA"},
+			latest:       []string{"serviceB"},
+			want:         []string{"serviceC", "serviceA", "serviceB"},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, ServiceOrder(tt.serviceNames, tt.writeOrder, tt.latest))
+		})
+	}
+}
+
+func TestUpdateDeviceRefForComposite(t *testing.T) {
+	t.Parallel()
+	old := map[string]map[string]pathmap.PathMapInterface{
+		"deviceA": {
+			"serviceA": pathmap.PathMap{"/a": pathmap.NewPathMapValueSafe([]string{"a"}, "a", make(map[string]string))},
+			"serviceB": pathmap.PathMap{"/b": pathmap.NewPathMapValueSafe([]string{"b"}, "b", make(map[string]string))},
+		},
+	}
+	got, err := testComposite.UpdateDeviceRefForComposite(map[string]map[string]pathmap.PathMapInterface{
+		"serviceA": {"deviceA": pathmap.PathMap{}},
+	}, old)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string]pathmap.PathMapInterface{
+		"deviceA": {
+			"serviceA": pathmap.PathMap{},
+			"serviceB": pathmap.PathMap{"/b": pathmap.NewPathMapValueSafe([]string{"b"}, "b", make(map[string]string))},
+		},
+	}, got)
+	// the old ref.json still tells the owners before the change
+	assert.Equal(t, pathmap.PathMap{"/a": pathmap.NewPathMapValueSafe([]string{"a"}, "a", make(map[string]string))}, old["deviceA"]["serviceA"])
+}
@@ -1,12 +1,28 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+)
 
 type Config struct {
 	GithubServerURL             string
 	SbServerURL                 string
 	YangFolderPath              string
 	TemporaryFilePathForLibyang string
+	APITimeout                  int
+	DeviceTimeout               int
+	TransactionHistorySize      int
+	LockMode                    string
+	LockPolicy                  string
+	LockWaitTimeout             int
+	ReconcileInterval           int
+	ReconcilePolicy             string
+	ReconcileExcludeDevices     []string
+	ReconcileMaxConcurrency     int
+	MergePolicy                 string
+	OnboardPolicy               string
 }
 
 var Cfg Config
@@ -35,4 +51,56 @@ func init() {
 	} else {
 		Cfg.TemporaryFilePathForLibyang = temporaryFilePathForLibyang
 	}
+
+	Cfg.APITimeout = lookupEnvInt("API_TIMEOUT", 300)
+	Cfg.DeviceTimeout = lookupEnvInt("DEVICE_TIMEOUT", 120)
+	Cfg.TransactionHistorySize = lookupEnvInt("TRANSACTION_HISTORY_SIZE", 1000)
+
+	if lockMode, ok := os.LookupEnv("LOCK_MODE"); !ok {
+		Cfg.LockMode = "device"
+	} else {
+		Cfg.LockMode = lockMode
+	}
+
+	if lockPolicy, ok := os.LookupEnv("LOCK_POLICY"); !ok {
+		Cfg.LockPolicy = "wait"
+	} else {
+		Cfg.LockPolicy = lockPolicy
+	}
+	Cfg.LockWaitTimeout = lookupEnvInt("LOCK_WAIT_TIMEOUT", 60)
+
+	Cfg.ReconcileInterval = lookupEnvInt("RECONCILE_INTERVAL", 0)
+	if reconcilePolicy, ok := os.LookupEnv("RECONCILE_POLICY"); !ok {
+		Cfg.ReconcilePolicy = "report"
+	} else {
+		Cfg.ReconcilePolicy = reconcilePolicy
+	}
+	if excludeDevices, ok := os.LookupEnv("RECONCILE_EXCLUDE_DEVICES"); ok && excludeDevices != "" {
+		Cfg.ReconcileExcludeDevices = strings.Split(excludeDevices, ",")
+	}
+	Cfg.ReconcileMaxConcurrency = lookupEnvInt("RECONCILE_MAX_CONCURRENCY", 4)
+
+	if mergePolicy, ok := os.LookupEnv("MERGE_POLICY"); !ok {
+		Cfg.MergePolicy = "replace"
+	} else {
+		Cfg.MergePolicy = mergePolicy
+	}
+
+	if onboardPolicy, ok := os.LookupEnv("ONBOARD_POLICY"); !ok {
+		Cfg.OnboardPolicy = "sync"
+	} else {
+		Cfg.OnboardPolicy = onboardPolicy
+	}
+}
+
+func lookupEnvInt(key string, defaultValue int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return intValue
 }
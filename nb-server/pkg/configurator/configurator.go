@@ -1,6 +1,7 @@
 package configurator
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/nttcom/ksot/nb-server/pkg/api"
@@ -11,6 +12,8 @@ var (
 	configureLogicMap = make(ConfigureLogicMap)
 )
 
+var ErrUnsupportedInterface = errors.New("unsupported interface")
+
 type ConfigureLogicMap map[string]func(string, []byte, []byte, api.SbApiInterface) (func() error, error)
 
 const (
@@ -19,7 +22,14 @@ const (
 )
 
 type ConfiguratorInterface interface {
-	Configure(map[string]string, map[string][]byte, map[string][]byte) error
+	Configure(map[string]string, map[string][]byte, map[string][]byte) (map[string]*Result, error)
+}
+
+// Result is the outcome of configuring a single device.
+type Result struct {
+	Configured bool   `json:"configured"`
+	RolledBack bool   `json:"rolledBack"`
+	Error      string `json:"error,omitempty"`
 }
 
 type Configurator struct {
@@ -36,21 +46,36 @@ func init() {
 	configureLogicMap[NETCONF] = netconfLogic
 }
 
-func (c *Configurator) Configure(deviceNameToIfMap map[string]string, deviceNameToConfigMap map[string][]byte, oldDeviceNameToConfigMap map[string][]byte) error {
+func (c *Configurator) Configure(deviceNameToIfMap map[string]string, deviceNameToConfigMap map[string][]byte, oldDeviceNameToConfigMap map[string][]byte) (map[string]*Result, error) {
+	results := make(map[string]*Result)
 	roolbackFuns := make(map[string]func() error)
 	for deviceName, iface := range deviceNameToIfMap {
-		rfunc, err := configureLogicMap[iface](deviceName, deviceNameToConfigMap[deviceName], oldDeviceNameToConfigMap[deviceName], c.sb)
+		results[deviceName] = &Result{}
+		configureLogic, ok := configureLogicMap[iface]
+		if !ok {
+			results[deviceName].Error = fmt.Sprintf("unsupported interface %v", iface)
+			return results, c.rollback(results, roolbackFuns, fmt.Errorf("Configure: %v: %w %v", deviceName, ErrUnsupportedInterface, iface))
+		}
+		rfunc, err := configureLogic(deviceName, deviceNameToConfigMap[deviceName], oldDeviceNameToConfigMap[deviceName], c.sb)
 		if err != nil {
-			successDevices := maps.Keys(roolbackFuns)
-			for i, deviceName := range successDevices {
-				err := roolbackFuns[deviceName]()
-				if err != nil {
-					return fmt.Errorf("Configure: failed roolback devices %v", successDevices[i:])
-				}
-			}
-			return fmt.Errorf("Configure: success roolback %v", successDevices)
+			results[deviceName].Error = err.Error()
+			return results, c.rollback(results, roolbackFuns, fmt.Errorf("Configure: %v: %w", deviceName, err))
 		}
 		roolbackFuns[deviceName] = rfunc
+		results[deviceName].Configured = true
+	}
+	return results, nil
+}
+
+func (c *Configurator) rollback(results map[string]*Result, roolbackFuns map[string]func() error, cause error) error {
+	successDevices := maps.Keys(roolbackFuns)
+	for i, deviceName := range successDevices {
+		err := roolbackFuns[deviceName]()
+		if err != nil {
+			results[deviceName].Error = err.Error()
+			return fmt.Errorf("%w: failed roolback devices %v", cause, successDevices[i:])
+		}
+		results[deviceName].RolledBack = true
 	}
-	return nil
+	return fmt.Errorf("%w: success roolback %v", cause, successDevices)
 }
@@ -2,12 +2,13 @@ package configurator
 
 import (
 	"github.com/nttcom/ksot/nb-server/pkg/api"
+	"github.com/nttcom/ksot/nb-server/pkg/config"
 )
 
 func netconfLogic(deviceName string, setconfig []byte, roolbackConfig []byte, sb api.SbApiInterface) (func() error, error) {
 	roolbackFunc := func() error {
-		return sb.PostFileRequest("/devices/netconf/"+deviceName, roolbackConfig, 120)
+		return sb.PostFileRequest("/devices/netconf/"+deviceName, roolbackConfig, config.Cfg.DeviceTimeout)
 	}
-	err := sb.PostFileRequest("/devices/netconf/"+deviceName, setconfig, 120)
+	err := sb.PostFileRequest("/devices/netconf/"+deviceName, setconfig, config.Cfg.DeviceTimeout)
 	return roolbackFunc, err
 }
@@ -18,10 +18,28 @@ func NewDiffInterface() DiffInterface {
 	return &Diff{}
 }
 
+// DiffPathmaps compares the pathmaps of every device in either map. A device only in newDeviceToPathmap is
+// diffed from an empty pathmap so that a device onboarded by the change is created as a whole,
+// and a device only in oldDeviceToPathmap is deleted as a whole.
 func (d *Diff) DiffPathmaps(oldDeviceToPathmap map[string]pathmap.PathMapInterface, newDeviceToPathmap map[string]pathmap.PathMapInterface) (map[string]*pathmap.DiffResult, error) {
 	result := make(map[string]*pathmap.DiffResult)
-	for deviceName, pathmapValue := range oldDeviceToPathmap {
-		diffValue, err := pathmapValue.Diff(newDeviceToPathmap[deviceName])
+	deviceNames := make(map[string]bool)
+	for deviceName := range oldDeviceToPathmap {
+		deviceNames[deviceName] = true
+	}
+	for deviceName := range newDeviceToPathmap {
+		deviceNames[deviceName] = true
+	}
+	for deviceName := range deviceNames {
+		oldPathmap, ok := oldDeviceToPathmap[deviceName]
+		if !ok {
+			oldPathmap = pathmap.PathMap{}
+		}
+		newPathmap, ok := newDeviceToPathmap[deviceName]
+		if !ok {
+			newPathmap = pathmap.PathMap{}
+		}
+		diffValue, err := oldPathmap.Diff(newPathmap)
 		if err != nil {
 			return nil, fmt.Errorf("DiffPathmaps: %w", err)
 		}
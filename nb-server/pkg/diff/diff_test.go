@@ -18,6 +18,11 @@ var (
 				"/num":    pathmap.NewPathMapValueSafe([]string{"num"}, 100, make(map[string]string)),
 			},
 		},
+		{
+			"deviceB": pathmap.PathMap{
+				"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "b", make(map[string]string)),
+			},
+		},
 	}
 	newDeviceToPathmaps = []map[string]pathmap.PathMapInterface{
 		{
@@ -27,6 +32,11 @@ var (
 				"/create_num": pathmap.NewPathMapValueSafe([]string{"create_num"}, 10000, make(map[string]string)),
 			},
 		},
+		{
+			"deviceC": pathmap.PathMap{
+				"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "c", make(map[string]string)),
+			},
+		},
 	}
 	wantDiffResult = []map[string]*pathmap.DiffResult{
 		{
@@ -40,11 +50,33 @@ var (
 				Delete: pathmap.PathMap{
 					"/bool": pathmap.NewPathMapValueSafe([]string{"bool"}, true, make(map[string]string)),
 				},
+				Previous: pathmap.PathMap{
+					"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "a", make(map[string]string)),
+				},
+			},
+		},
+		{
+			"deviceB": {
+				Create: pathmap.PathMap{},
+				Update: pathmap.PathMap{},
+				Delete: pathmap.PathMap{
+					"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "b", make(map[string]string)),
+				},
+				Previous: pathmap.PathMap{},
+			},
+			"deviceC": {
+				Create: pathmap.PathMap{
+					"/string": pathmap.NewPathMapValueSafe([]string{"string"}, "c", make(map[string]string)),
+				},
+				Update:   pathmap.PathMap{},
+				Delete:   pathmap.PathMap{},
+				Previous: pathmap.PathMap{},
 			},
 		},
 	}
 	wantErrs = []error{
 		nil,
+		nil,
 	}
 )
 
@@ -56,7 +88,7 @@ func TestDiffPathMap(t *testing.T) {
 		want    map[string]*pathmap.DiffResult
 		wantErr error
 	}
-	testNames := []string{"正常系: 文字列、bool、intを要素として含むpathmapのdiff取得"}
+	testNames := []string{"正常系: 文字列、bool、intを要素として含むpathmapのdiff取得", "正常系: 新しいデバイスと消えたデバイス"}
 	tests := make(map[string]test)
 	for i, name := range testNames {
 		tests[name] = test{
@@ -0,0 +1,310 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+)
+
+const (
+	CHANGE_CREATE = "create"
+	CHANGE_UPDATE = "update"
+	CHANGE_DELETE = "delete"
+)
+
+// CONTEXT_LINES is the number of unchanged lines around each hunk of a unified diff.
+const CONTEXT_LINES = 3
+
+// Change is a leaf or leaf-list of set.json changed between two configs.
+type Change struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// Rendering is the human-readable diff of the set.json of a device.
+type Rendering struct {
+	JSON    string   `json:"json"`
+	XML     string   `json:"xml"`
+	Changes []Change `json:"changes"`
+}
+
+// Render returns the diff of the set.json at path from before to after.
+// beforeXML and afterXML are the same configs converted to XML, and are not rendered if both are nil.
+func Render(path string, before []byte, after []byte, beforeXML []byte, afterXML []byte, options TreeOptions) (*Rendering, error) {
+	beforeJSON, err := indentJSON(before)
+	if err != nil {
+		return nil, fmt.Errorf("Render: %w", err)
+	}
+	afterJSON, err := indentJSON(after)
+	if err != nil {
+		return nil, fmt.Errorf("Render: %w", err)
+	}
+	changes, err := ChangesOf(before, after, options)
+	if err != nil {
+		return nil, fmt.Errorf("Render: %w", err)
+	}
+	result := &Rendering{
+		JSON:    UnifiedDiff("a"+path, "b"+path, beforeJSON, afterJSON),
+		Changes: changes,
+	}
+	if beforeXML != nil || afterXML != nil {
+		xmlPath := strings.TrimSuffix(path, ".json") + ".xml"
+		result.XML = UnifiedDiff("a"+xmlPath, "b"+xmlPath, string(beforeXML), string(afterXML))
+	}
+	return result, nil
+}
+
+func indentJSON(b []byte) (string, error) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return "", fmt.Errorf("indentJSON: %w", err)
+	}
+	return buf.String() + "\n", nil
+}
+
+// ChangesOf returns the leaves changed from the config before to after, sorted by path.
+func ChangesOf(before []byte, after []byte, options TreeOptions) ([]Change, error) {
+	beforeTree, err := parseConfig(before)
+	if err != nil {
+		return nil, fmt.Errorf("ChangesOf: %w", err)
+	}
+	afterTree, err := parseConfig(after)
+	if err != nil {
+		return nil, fmt.Errorf("ChangesOf: %w", err)
+	}
+	result, err := DiffTrees(beforeTree, afterTree, options)
+	if err != nil {
+		return nil, fmt.Errorf("ChangesOf: %w", err)
+	}
+	return result, nil
+}
+
+func parseConfig(b []byte) (*iomap.OrderedMap, error) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return iomap.New(), nil
+	}
+	omap, err := orderedmap.New(b)
+	if err != nil {
+		return nil, fmt.Errorf("parseConfig: %w", err)
+	}
+	return omap.Value, nil
+}
+
+// Text returns the changes one per line such as "~ /a/b: 1 -> 2".
+func Text(changes []Change) string {
+	var b strings.Builder
+	for _, v := range changes {
+		switch v.Type {
+		case CHANGE_CREATE:
+			fmt.Fprintf(&b, "+ %v: %v\n", v.Path, v.After)
+		case CHANGE_UPDATE:
+			fmt.Fprintf(&b, "~ %v: %v -> %v\n", v.Path, v.Before, v.After)
+		case CHANGE_DELETE:
+			fmt.Fprintf(&b, "- %v: %v\n", v.Path, v.Before)
+		}
+	}
+	return b.String()
+}
+
+type lineOp struct {
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns the unified diff of the texts before and after, or "" if they are equal.
+func UnifiedDiff(fromName string, toName string, before string, after string) string {
+	ops := diffLines(splitLines(before), splitLines(after))
+	changed := make([]int, 0)
+	for i, v := range ops {
+		if v.kind != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %v\n+++ %v\n", fromName, toName)
+	// line numbers of ops[i] in before and after
+	beforeLines := make([]int, len(ops)+1)
+	afterLines := make([]int, len(ops)+1)
+	for i, v := range ops {
+		beforeLines[i+1], afterLines[i+1] = beforeLines[i], afterLines[i]
+		if v.kind != '+' {
+			beforeLines[i+1]++
+		}
+		if v.kind != '-' {
+			afterLines[i+1]++
+		}
+	}
+	for i := 0; i < len(changed); {
+		start := changed[i] - CONTEXT_LINES
+		if start < 0 {
+			start = 0
+		}
+		end := changed[i] + 1
+		for i < len(changed) && changed[i] <= end+2*CONTEXT_LINES {
+			end = changed[i] + 1
+			i++
+		}
+		end += CONTEXT_LINES
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fmt.Fprintf(&b, "@@ -%v +%v @@\n",
+			hunkRange(beforeLines[start], beforeLines[end]-beforeLines[start]),
+			hunkRange(afterLines[start], afterLines[end]-afterLines[start]))
+		for _, v := range ops[start:end] {
+			b.WriteByte(v.kind)
+			b.WriteString(v.line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// hunkRange formats the range of a hunk from the 0-based line start. An empty range refers to the line before it.
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%v,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%v", start+1)
+	}
+	return fmt.Sprintf("%v,%v", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the shortest edit script from a to b by the linear space variant of the Myers algorithm,
+// which splits the problem at the middle snake of an optimal path. The deletions of a change come before its insertions.
+func diffLines(a []string, b []string) []lineOp {
+	size := (len(a)+len(b)+1)/2 + 1
+	d := &lineDiff{
+		forward:  make([]int, 2*size+1),
+		backward: make([]int, 2*size+1),
+		offset:   size,
+		result:   make([]lineOp, 0, len(a)+len(b)),
+	}
+	d.compare(a, b)
+	result := d.result
+	for start := 0; start < len(result); start++ {
+		if result[start].kind == ' ' {
+			continue
+		}
+		end := start
+		for end < len(result) && result[end].kind != ' ' {
+			end++
+		}
+		sort.SliceStable(result[start:end], func(i, j int) bool {
+			return result[start+i].kind == '-' && result[start+j].kind == '+'
+		})
+		start = end
+	}
+	return result
+}
+
+// lineDiff holds the furthest reaching paths of both directions, which are reused by every step of the recursion.
+type lineDiff struct {
+	forward  []int
+	backward []int
+	offset   int
+	result   []lineOp
+}
+
+func (d *lineDiff) emit(kind byte, lines []string) {
+	for _, v := range lines {
+		d.result = append(d.result, lineOp{kind: kind, line: v})
+	}
+}
+
+func (d *lineDiff) compare(a []string, b []string) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	d.emit(' ', a[:prefix])
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	tail := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+	switch {
+	case len(a) == 0:
+		d.emit('+', b)
+	case len(b) == 0:
+		d.emit('-', a)
+	default:
+		// both sides differ at their ends, so the edit script has at least two edits and both halves are smaller
+		x, y, u, v := d.middleSnake(a, b)
+		d.compare(a[:x], b[:y])
+		d.emit(' ', a[x:u])
+		d.compare(a[u:], b[v:])
+	}
+	d.emit(' ', tail)
+}
+
+// middleSnake returns the start (x, y) and the end (u, v) of the middle snake of an optimal path from a to b.
+// backward holds the paths from the ends of a and b, indexed by the diagonals of the reversed sequences.
+func (d *lineDiff) middleSnake(a []string, b []string) (int, int, int, int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	d.forward[d.offset+1] = 0
+	d.backward[d.offset+1] = 0
+	for step := 0; step <= (n+m+1)/2; step++ {
+		for k := -step; k <= step; k += 2 {
+			x := d.next(d.forward, k, step)
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			d.forward[d.offset+k] = x
+			if c := delta - k; odd && c >= -(step-1) && c <= step-1 && x+d.backward[d.offset+c] >= n {
+				return startX, startY, x, y
+			}
+		}
+		for c := -step; c <= step; c += 2 {
+			x := d.next(d.backward, c, step)
+			y := x - c
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			d.backward[d.offset+c] = x
+			if k := delta - c; !odd && k >= -step && k <= step && x+d.forward[d.offset+k] >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	// unreachable: the paths of both directions always meet
+	return 0, 0, n, m
+}
+
+// next returns the x where the path on diagonal k starts at step, after an insertion or a deletion.
+func (d *lineDiff) next(v []int, k int, step int) int {
+	if k == -step || (k != step && v[d.offset+k-1] < v[d.offset+k+1]) {
+		return v[d.offset+k+1]
+	}
+	return v[d.offset+k-1] + 1
+}
@@ -0,0 +1,183 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		before string
+		after  string
+		want   string
+	}
+	tests := map[string]test{
+		"正常系: 変更なし": {
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "",
+		},
+		"正常系: 1行の更新": {
+			before: "a\nb\nc\nd\ne\nf\ng\nh\n",
+			after:  "a\nb\nc\nd\nE\nf\ng\nh\n",
+			want: "--- a/x\n+++ b/x\n" +
+				"@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n",
+		},
+		"正常系: 離れた変更は別のハンク": {
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			after:  "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			want: "--- a/x\n+++ b/x\n" +
+				"@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n" +
+				"@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+		"正常系: 新規ファイル": {
+			before: "",
+			after:  "a\nb\n",
+			want:   "--- a/x\n+++ b/x\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, UnifiedDiff("a/x", "b/x", tt.before, tt.after))
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		before      string
+		after       string
+		beforeXML   string
+		afterXML    string
+		wantJSON    string
+		wantXML     string
+		wantChanges []Change
+		wantErr     bool
+	}
+	tests := map[string]test{
+		"正常系: リーフの作成、更新、削除": {
+			before:    `{"A":{"mtu":1500,"desc":"old"},"B":[{"name":"b0","v":1}]}`,
+			after:     `{"A":{"mtu":9000},"B":[{"name":"b0","v":1}],"C":"c"}`,
+			beforeXML: "<A>\n  <mtu>1500</mtu>\n  <desc>old</desc>\n</A>\n",
+			afterXML:  "<A>\n  <mtu>9000</mtu>\n</A>\n",
+			wantJSON: "--- a/Devices/deviceA/set.json\n+++ b/Devices/deviceA/set.json\n" +
+				"@@ -1,12 +1,12 @@\n" +
+				" {\n" +
+				"   \"A\": {\n" +
+				"-    \"mtu\": 1500,\n" +
+				"-    \"desc\": \"old\"\n" +
+				"+    \"mtu\": 9000\n" +
+				"   },\n" +
+				"   \"B\": [\n" +
+				"     {\n" +
+				"       \"name\": \"b0\",\n" +
+				"       \"v\": 1\n" +
+				"     }\n" +
+				"-  ]\n" +
+				"+  ],\n" +
+				"+  \"C\": \"c\"\n" +
+				" }\n",
+			wantXML: "--- a/Devices/deviceA/set.xml\n+++ b/Devices/deviceA/set.xml\n" +
+				"@@ -1,4 +1,3 @@\n" +
+				" <A>\n" +
+				"-  <mtu>1500</mtu>\n" +
+				"-  <desc>old</desc>\n" +
+				"+  <mtu>9000</mtu>\n" +
+				" </A>\n",
+			wantChanges: []Change{
+				{Path: "/A/desc", Type: CHANGE_DELETE, Before: "old"},
+				{Path: "/A/mtu", Type: CHANGE_UPDATE, Before: float64(1500), After: float64(9000)},
+				{Path: "/C", Type: CHANGE_CREATE, After: "c"},
+			},
+		},
+		"正常系: 変更なし": {
+			before:      `{"A":{"mtu":1500}}`,
+			after:       `{"A": {"mtu": 1500}}`,
+			wantChanges: []Change{},
+		},
+		"異常系: 不正なJSON": {
+			before:  `{"A":`,
+			after:   `{}`,
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var beforeXML, afterXML []byte
+			if tt.beforeXML != "" || tt.afterXML != "" {
+				beforeXML, afterXML = []byte(tt.beforeXML), []byte(tt.afterXML)
+			}
+			got, err := Render("/Devices/deviceA/set.json", []byte(tt.before), []byte(tt.after), beforeXML, afterXML, TreeOptions{})
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantJSON, got.JSON)
+			assert.Equal(t, tt.wantXML, got.XML)
+			assert.Equal(t, tt.wantChanges, got.Changes)
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	t.Parallel()
+	// the edit script must rebuild both sides with the fewest edits, which is counted by the longest common subsequence
+	lcs := func(a []string, b []string) int {
+		table := make([][]int, len(a)+1)
+		for i := range table {
+			table[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				switch {
+				case a[i] == b[j]:
+					table[i][j] = table[i+1][j+1] + 1
+				case table[i+1][j] > table[i][j+1]:
+					table[i][j] = table[i+1][j]
+				default:
+					table[i][j] = table[i][j+1]
+				}
+			}
+		}
+		return table[0][0]
+	}
+	seed := uint32(1)
+	random := func(n int) int {
+		seed = seed*1103515245 + 12345
+		return int(seed>>16) % n
+	}
+	for i := 0; i < 200; i++ {
+		a := make([]string, random(12))
+		for j := range a {
+			a[j] = string(rune('a' + random(4)))
+		}
+		b := make([]string, random(12))
+		for j := range b {
+			b[j] = string(rune('a' + random(4)))
+		}
+		ops := diffLines(a, b)
+		gotA, gotB, edits := make([]string, 0), make([]string, 0), 0
+		for _, v := range ops {
+			if v.kind != '+' {
+				gotA = append(gotA, v.line)
+			}
+			if v.kind != '-' {
+				gotB = append(gotB, v.line)
+			}
+			if v.kind != ' ' {
+				edits++
+			}
+		}
+		assert.Equal(t, a, gotA)
+		assert.Equal(t, b, gotB)
+		assert.Equal(t, len(a)+len(b)-2*lcs(a, b), edits, "%v %v", a, b)
+	}
+}
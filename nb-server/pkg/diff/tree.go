@@ -0,0 +1,121 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+)
+
+// TreeOptions tells DiffTrees how to identify the entries of a list.
+type TreeOptions struct {
+	// ListKeys are the keys of the lists of the device models. A list not in ListKeys is keyed by the first leaf of its entries.
+	ListKeys yangpath.ListKeys
+}
+
+// DiffTrees compares two complete configs and returns every changed leaf and leaf-list in pathmap path syntax,
+// sorted by path. List entries are matched by their keys regardless of their order in the list.
+func DiffTrees(before *iomap.OrderedMap, after *iomap.OrderedMap, options TreeOptions) ([]Change, error) {
+	beforeLeaves, err := Leaves(before, options)
+	if err != nil {
+		return nil, fmt.Errorf("DiffTrees: before: %w", err)
+	}
+	afterLeaves, err := Leaves(after, options)
+	if err != nil {
+		return nil, fmt.Errorf("DiffTrees: after: %w", err)
+	}
+	return compareLeaves(beforeLeaves, afterLeaves), nil
+}
+
+// Leaves returns every leaf and leaf-list of a complete config keyed by its path in pathmap path syntax.
+func Leaves(tree *iomap.OrderedMap, options TreeOptions) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if err := flattenTree("", tree, options, result); err != nil {
+		return nil, fmt.Errorf("Leaves: %w", err)
+	}
+	return result, nil
+}
+
+func compareLeaves(beforeLeaves map[string]interface{}, afterLeaves map[string]interface{}) []Change {
+	result := make([]Change, 0)
+	for path, beforeValue := range beforeLeaves {
+		afterValue, ok := afterLeaves[path]
+		switch {
+		case !ok:
+			result = append(result, Change{Path: path, Type: CHANGE_DELETE, Before: beforeValue})
+		case !pathmap.EqualValue(beforeValue, afterValue):
+			result = append(result, Change{Path: path, Type: CHANGE_UPDATE, Before: beforeValue, After: afterValue})
+		}
+	}
+	for path, afterValue := range afterLeaves {
+		if _, ok := beforeLeaves[path]; !ok {
+			result = append(result, Change{Path: path, Type: CHANGE_CREATE, After: afterValue})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// flattenTree collects the leaves of omap keyed by their path.
+// An empty container is kept as a leaf so that a presence container is not lost.
+func flattenTree(prefix string, omap *iomap.OrderedMap, options TreeOptions, result map[string]interface{}) error {
+	if omap == nil {
+		return nil
+	}
+	for _, k := range omap.Keys() {
+		v, _ := omap.Get(k)
+		path := prefix + "/" + k
+		switch vv := v.(type) {
+		case iomap.OrderedMap:
+			if len(vv.Keys()) == 0 {
+				result[path] = vv
+				continue
+			}
+			if err := flattenTree(path, &vv, options, result); err != nil {
+				return err
+			}
+		case []interface{}:
+			if !isEntryList(vv) {
+				result[path] = vv
+				continue
+			}
+			seen := make(map[string]bool)
+			keyNames := options.ListKeys.Get(path)
+			for _, elm := range vv {
+				entry := elm.(iomap.OrderedMap)
+				segment, err := orderedmap.EntrySegment(k, entry, keyNames)
+				if err != nil {
+					return fmt.Errorf("flattenTree: %v: %w", path, err)
+				}
+				entryPath := prefix + "/" + segment.String()
+				if seen[entryPath] {
+					return fmt.Errorf("flattenTree: duplicated entry %v", entryPath)
+				}
+				seen[entryPath] = true
+				if err := flattenTree(entryPath, &entry, options, result); err != nil {
+					return err
+				}
+			}
+		default:
+			result[path] = v
+		}
+	}
+	return nil
+}
+
+func isEntryList(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, v := range list {
+		if _, ok := v.(iomap.OrderedMap); !ok {
+			return false
+		}
+	}
+	return true
+}
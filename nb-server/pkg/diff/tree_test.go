@@ -0,0 +1,83 @@
+package diff
+
+import (
+	"testing"
+
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func orderedmapValue(t *testing.T, s string) *iomap.OrderedMap {
+	omap, err := orderedmap.New([]byte(s))
+	assert.Nil(t, err)
+	return omap.Value
+}
+
+func TestDiffTrees(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		before  string
+		after   string
+		options TreeOptions
+		want    []Change
+		wantErr bool
+	}
+	tests := map[string]test{
+		"正常系: リストの順序は無視": {
+			before: `{"A":{"B":[{"name":"b0","v":1},{"name":"b1","v":2}]}}`,
+			after:  `{"A":{"B":[{"name":"b1","v":2},{"name":"b0","v":1}]}}`,
+			want:   []Change{},
+		},
+		"正常系: エントリの追加と削除": {
+			before: `{"A":{"B":[{"name":"b0","v":1}]}}`,
+			after:  `{"A":{"B":[{"name":"b1","v":1}]}}`,
+			want: []Change{
+				{Path: "/A/B[name=b0]/name", Type: CHANGE_DELETE, Before: "b0"},
+				{Path: "/A/B[name=b0]/v", Type: CHANGE_DELETE, Before: float64(1)},
+				{Path: "/A/B[name=b1]/name", Type: CHANGE_CREATE, After: "b1"},
+				{Path: "/A/B[name=b1]/v", Type: CHANGE_CREATE, After: float64(1)},
+			},
+		},
+		"正常系: 複数キーのリスト": {
+			before:  `{"route":[{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1},{"prefix":"10.0.0.0/8","next-hop":"2.2.2.2","metric":1}]}`,
+			after:   `{"route":[{"prefix":"10.0.0.0/8","next-hop":"2.2.2.2","metric":5},{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1}]}`,
+			options: TreeOptions{ListKeys: map[string][]string{"/route": {"prefix", "next-hop"}}},
+			want: []Change{
+				{Path: "/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/metric", Type: CHANGE_UPDATE, Before: float64(1), After: float64(5)},
+			},
+		},
+		"正常系: リーフリストと空コンテナ": {
+			before: `{"A":{"list":["a","b"]}}`,
+			after:  `{"A":{"list":["a"],"presence":{}}}`,
+			want: []Change{
+				{Path: "/A/list", Type: CHANGE_UPDATE, Before: []interface{}{"a", "b"}, After: []interface{}{"a"}},
+				{Path: "/A/presence", Type: CHANGE_CREATE, After: *orderedmapValue(t, `{}`)},
+			},
+		},
+		"異常系: エントリの重複": {
+			before:  `{"B":[{"name":"b0","v":1},{"name":"b0","v":2}]}`,
+			after:   `{}`,
+			wantErr: true,
+		},
+		"異常系: キーがないエントリ": {
+			before:  `{}`,
+			after:   `{"route":[{"prefix":"10.0.0.0/8"}]}`,
+			options: TreeOptions{ListKeys: map[string][]string{"/route": {"prefix", "next-hop"}}},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := DiffTrees(orderedmapValue(t, tt.before), orderedmapValue(t, tt.after), tt.options)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package drift
+
+import (
+	"fmt"
+	"time"
+
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+)
+
+const (
+	// the path exists on the device but not in set.json
+	TYPE_ADDED = "added"
+	// the path exists in set.json but not on the device
+	TYPE_REMOVED = "removed"
+	// the path exists in both with different values
+	TYPE_CHANGED = "changed"
+)
+
+type Drift struct {
+	Path     string      `json:"path"`
+	Type     string      `json:"type"`
+	Expected interface{} `json:"expected,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+	Owned    bool        `json:"owned"`
+	Services []string    `json:"services,omitempty"`
+}
+
+type Report struct {
+	Device    string    `json:"device"`
+	InSync    bool      `json:"inSync"`
+	Drifts    []Drift   `json:"drifts"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+type DriftInterface interface {
+	// Detect compares the intended config (set.json) with the actual config of deviceName.
+	// serviceToPathmap is the ref.json of the device and decides which drifted paths are owned by a service,
+	// including the leaves under a path of a service. options identify the list entries of the device models.
+	Detect(deviceName string, intended *iomap.OrderedMap, actual *iomap.OrderedMap, serviceToPathmap map[string]pathmap.PathMapInterface, options diff.TreeOptions) *Report
+}
+
+type Detector struct{}
+
+var _ DriftInterface = (*Detector)(nil)
+
+func NewDriftInterface() DriftInterface {
+	return &Detector{}
+}
+
+func (d *Detector) Detect(deviceName string, intended *iomap.OrderedMap, actual *iomap.OrderedMap, serviceToPathmap map[string]pathmap.PathMapInterface, options diff.TreeOptions) *Report {
+	report := &Report{Device: deviceName, Drifts: make([]Drift, 0), CheckedAt: time.Now()}
+	owners, err := pathmap.NewOwners(options.ListKeys, serviceToPathmap)
+	if err != nil {
+		report.Error = fmt.Sprintf("Detect: %v", err)
+		return report
+	}
+	changes, err := diff.DiffTrees(intended, actual, options)
+	if err != nil {
+		report.Error = fmt.Sprintf("Detect: %v", err)
+		return report
+	}
+	for _, v := range changes {
+		report.Drifts = append(report.Drifts, newDrift(v.Path, driftTypes[v.Type], v.Before, v.After, owners))
+	}
+	report.InSync = len(report.Drifts) == 0
+	return report
+}
+
+// driftTypes maps a change from the intended to the actual config to its drift type.
+var driftTypes = map[string]string{
+	diff.CHANGE_CREATE: TYPE_ADDED,
+	diff.CHANGE_DELETE: TYPE_REMOVED,
+	diff.CHANGE_UPDATE: TYPE_CHANGED,
+}
+
+func newDrift(path string, driftType string, expected interface{}, actual interface{}, owners pathmap.Owners) Drift {
+	services := append(make([]string, 0), owners(path)...)
+	return Drift{
+		Path:     path,
+		Type:     driftType,
+		Expected: expected,
+		Actual:   actual,
+		Owned:    len(services) != 0,
+		Services: services,
+	}
+}
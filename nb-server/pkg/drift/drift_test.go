@@ -0,0 +1,93 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDrift = NewDriftInterface()
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		intended string
+		actual   string
+		refs     map[string]pathmap.PathMapInterface
+		options  diff.TreeOptions
+		want     []Drift
+	}
+	tests := map[string]test{
+		"正常系: 差分なし": {
+			intended: `{"A":{"B":"b"}}`,
+			actual:   `{"A":{"B":"b"}}`,
+			refs:     map[string]pathmap.PathMapInterface{},
+			want:     []Drift{},
+		},
+		"正常系: 追加、削除、変更": {
+			intended: `{"A":{"B":"b","C":"c"},"D":{"E":[{"F":"f0","G":"g0"}]}}`,
+			actual:   `{"A":{"B":"b"},"D":{"E":[{"F":"f0","G":"g1"}]},"H":"h"}`,
+			refs: map[string]pathmap.PathMapInterface{
+				"serviceA": pathmap.PathMap{
+					"/D/E[F=f0]/G": pathmap.NewPathMapValueSafe([]string{"D", "E[F=f0]", "G"}, "g0", make(map[string]string)),
+				},
+			},
+			want: []Drift{
+				{Path: "/A/C", Type: TYPE_REMOVED, Expected: "c", Services: []string{}},
+				{Path: "/D/E[F=f0]/G", Type: TYPE_CHANGED, Expected: "g0", Actual: "g1", Owned: true, Services: []string{"serviceA"}},
+				{Path: "/H", Type: TYPE_ADDED, Actual: "h", Services: []string{}},
+			},
+		},
+		"正常系: コンテナを所有するサービスはその配下のリーフを所有": {
+			intended: `{"A":{"B":"b","C":"c"}}`,
+			actual:   `{"A":{"B":"b","C":"x"}}`,
+			refs: map[string]pathmap.PathMapInterface{
+				"serviceA": pathmap.PathMap{
+					"/A": pathmap.NewPathMapValueSafe([]string{"A"}, map[string]interface{}{"B": "b", "C": "c"}, make(map[string]string)),
+				},
+			},
+			want: []Drift{
+				{Path: "/A/C", Type: TYPE_CHANGED, Expected: "c", Actual: "x", Owned: true, Services: []string{"serviceA"}},
+			},
+		},
+		"正常系: リストを所有するサービスはその要素のリーフを所有": {
+			intended: `{"interfaces":{"interface":[{"name":"eth0","mtu":1500}]}}`,
+			actual:   `{"interfaces":{"interface":[{"name":"eth0","mtu":9000}]}}`,
+			refs: map[string]pathmap.PathMapInterface{
+				"serviceA": pathmap.PathMap{
+					"/interfaces/interface": pathmap.NewPathMapValueSafe([]string{"interfaces", "interface"}, []interface{}{map[string]interface{}{"name": "eth0", "mtu": 1500}}, make(map[string]string)),
+				},
+			},
+			options: diff.TreeOptions{ListKeys: yangpath.ListKeys{"/interfaces/interface": {"name"}}},
+			want: []Drift{
+				{Path: "/interfaces/interface[name=eth0]/mtu", Type: TYPE_CHANGED, Expected: float64(1500), Actual: float64(9000), Owned: true, Services: []string{"serviceA"}},
+			},
+		},
+		"正常系: モデルの複数キーでリストの要素を識別": {
+			intended: `{"route":[{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1},{"prefix":"10.0.0.0/8","next-hop":"2.2.2.2","metric":2}]}`,
+			actual:   `{"route":[{"prefix":"10.0.0.0/8","next-hop":"2.2.2.2","metric":3},{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1}]}`,
+			refs:     map[string]pathmap.PathMapInterface{},
+			options:  diff.TreeOptions{ListKeys: yangpath.ListKeys{"/route": {"prefix", "next-hop"}}},
+			want: []Drift{
+				{Path: "/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/metric", Type: TYPE_CHANGED, Expected: float64(2), Actual: float64(3), Services: []string{}},
+			},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			intended, err := orderedmap.New([]byte(tt.intended))
+			assert.Nil(t, err)
+			actual, err := orderedmap.New([]byte(tt.actual))
+			assert.Nil(t, err)
+			report := testDrift.Detect("deviceA", intended.Value, actual.Value, tt.refs, tt.options)
+			assert.Equal(t, tt.want, report.Drifts)
+			assert.Equal(t, len(tt.want) == 0, report.InSync)
+		})
+	}
+}
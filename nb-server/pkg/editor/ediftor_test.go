@@ -85,9 +85,150 @@ func TestEditConfigByPathmapDiff(t *testing.T) {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			err := testEditor.EditConfigByPathmapDiff(tt.arg1, tt.arg2)
+			err := testEditor.EditConfigByPathmapDiff(tt.arg1, tt.arg2, nil)
 			assert.Equal(t, tt.wantErr, err)
 			assert.Equal(t, tt.want, tt.arg1)
 		})
 	}
 }
+
+func TestEditConfigByPathmapDiffForContainer(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		config string
+		// running is the running config of the device, which the leaf-lists are changed from if it is set
+		running string
+		diff    *pathmap.DiffResult
+		want    string
+	}
+	container, err := orderedmap.New([]byte(`{"B":"b1","C":{"D":"d"}}`))
+	assert.Nil(t, err)
+	entry, err := orderedmap.New([]byte(`{"F":"f1","G":"g1"}`))
+	assert.Nil(t, err)
+	tests := map[string]test{
+		"正常系: コンテナの作成は管理外の要素を残す": {
+			config: `{"A":{"B":"b0","X":"x"}}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{"/A": pathmap.NewPathMapValueSafe([]string{"A"}, *container.Value, make(map[string]string))},
+				Update: pathmap.PathMap{},
+				Delete: pathmap.PathMap{},
+			},
+			want: `{"A":{"B":"b1","X":"x","C":{"D":"d"}}}`,
+		},
+		"正常系: replaceはコンテナ全体を置き換える": {
+			config: `{"A":{"B":"b0","X":"x"}}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{"/A": pathmap.NewPathMapValueSafe([]string{"A"}, *container.Value, map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_REPLACE})},
+				Update: pathmap.PathMap{},
+				Delete: pathmap.PathMap{"/A/B": pathmap.NewPathMapValueSafe([]string{"A", "B"}, "b0", make(map[string]string))},
+			},
+			want: `{"A":{"B":"b1","C":{"D":"d"}}}`,
+		},
+		"正常系: replaceはリスト要素全体を置き換える": {
+			config: `{"E":[{"F":"f0","G":"g0"},{"F":"f1","G":"g0","H":"h"}]}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{},
+				Update: pathmap.PathMap{"/E[F=f1]": pathmap.NewPathMapValueSafe([]string{"E[F=f1]"}, *entry.Value, map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_REPLACE})},
+				Delete: pathmap.PathMap{},
+			},
+			want: `{"E":[{"F":"f0","G":"g0"},{"F":"f1","G":"g1"}]}`,
+		},
+		"正常系: deleteはパスを削除し、その取り消しでは復元しない": {
+			config: `{"A":{"B":"b0","X":"x"},"E":[{"F":"f0","G":"g0"}]}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{"/A/X": pathmap.NewPathMapValueSafe([]string{"A", "X"}, "", map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_DELETE})},
+				Update: pathmap.PathMap{},
+				Delete: pathmap.PathMap{"/E[F=f0]/G": pathmap.NewPathMapValueSafe([]string{"E[F=f0]", "G"}, "g0", map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_DELETE})},
+			},
+			want: `{"A":{"B":"b0"},"E":[{"F":"f0","G":"g0"}]}`,
+		},
+		"正常系: リスト要素の削除": {
+			config: `{"E":[{"F":"f0","G":"g0"},{"F":"f1","G":"g1"}]}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{},
+				Update: pathmap.PathMap{},
+				Delete: pathmap.PathMap{"/E[F=f1]": pathmap.NewPathMapValueSafe([]string{"E[F=f1]"}, *entry.Value, make(map[string]string))},
+			},
+			want: `{"E":[{"F":"f0","G":"g0"}]}`,
+		},
+		"正常系: リーフリストの更新は管理外の要素を残す": {
+			config: `{"A":{"L":["manual","l0","l1"]}}`,
+			diff: &pathmap.DiffResult{
+				Create:   pathmap.PathMap{},
+				Update:   pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l1", "l2"}, make(map[string]string))},
+				Delete:   pathmap.PathMap{},
+				Previous: pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l0", "l1"}, make(map[string]string))},
+			},
+			want: `{"A":{"L":["manual","l1","l2"]}}`,
+		},
+		"正常系: リーフリストの作成は既存の要素に追加": {
+			config: `{"A":{"L":["manual"]}}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l0"}, make(map[string]string))},
+				Update: pathmap.PathMap{},
+				Delete: pathmap.PathMap{},
+			},
+			want: `{"A":{"L":["manual","l0"]}}`,
+		},
+		"正常系: リーフリストの削除は以前の寄与だけを削除": {
+			config: `{"A":{"L":["manual","l0"],"M":["l0"]}}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{},
+				Update: pathmap.PathMap{},
+				Delete: pathmap.PathMap{
+					"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l0"}, make(map[string]string)),
+					"/A/M": pathmap.NewPathMapValueSafe([]string{"A", "M"}, []string{"l0"}, make(map[string]string)),
+				},
+			},
+			want: `{"A":{"L":["manual"]}}`,
+		},
+		"正常系: リーフリストの更新は実機で手動追加された要素を残す": {
+			config:  `{"A":{"L":["l0","l1"]}}`,
+			running: `{"A":{"L":["l0","manual","l1"]}}`,
+			diff: &pathmap.DiffResult{
+				Create:   pathmap.PathMap{},
+				Update:   pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l1", "l2"}, make(map[string]string))},
+				Delete:   pathmap.PathMap{},
+				Previous: pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l0", "l1"}, make(map[string]string))},
+			},
+			want: `{"A":{"L":["manual","l1","l2"]}}`,
+		},
+		"正常系: ユーザー順のリーフリストの並べ替え": {
+			config: `{"A":{"L":["l0","manual","l1"]}}`,
+			diff: &pathmap.DiffResult{
+				Create:   pathmap.PathMap{},
+				Update:   pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l1", "l0"}, map[string]string{pathmap.OPTION_ORDERED_BY: pathmap.ORDERED_BY_USER})},
+				Delete:   pathmap.PathMap{},
+				Previous: pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l0", "l1"}, map[string]string{pathmap.OPTION_ORDERED_BY: pathmap.ORDERED_BY_USER})},
+			},
+			want: `{"A":{"L":["l1","manual","l0"]}}`,
+		},
+		"正常系: replaceはリーフリスト全体を置き換える": {
+			config: `{"A":{"L":["manual","l0"]}}`,
+			diff: &pathmap.DiffResult{
+				Create: pathmap.PathMap{},
+				Update: pathmap.PathMap{"/A/L": pathmap.NewPathMapValueSafe([]string{"A", "L"}, []string{"l1"}, map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_REPLACE})},
+				Delete: pathmap.PathMap{},
+			},
+			want: `{"A":{"L":["l1"]}}`,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			config, err := orderedmap.New([]byte(tt.config))
+			assert.Nil(t, err)
+			running := make(map[string]orderedmap.OrderedmapInterfaces)
+			if tt.running != "" {
+				running["deviceA"], err = orderedmap.New([]byte(tt.running))
+				assert.Nil(t, err)
+			}
+			err = testEditor.EditConfigByPathmapDiff(map[string]orderedmap.OrderedmapInterfaces{"deviceA": config}, map[string]*pathmap.DiffResult{"deviceA": tt.diff}, running)
+			assert.Nil(t, err)
+			got, err := config.MakeByte()
+			assert.Nil(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
@@ -2,13 +2,15 @@ package editor
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
 	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
 )
 
 type EditorInterface interface {
-	EditConfigByPathmapDiff(map[string]orderedmap.OrderedmapInterfaces, map[string]*pathmap.DiffResult) error
+	EditConfigByPathmapDiff(map[string]orderedmap.OrderedmapInterfaces, map[string]*pathmap.DiffResult, map[string]orderedmap.OrderedmapInterfaces) error
 }
 
 type Editor struct{}
@@ -19,34 +21,95 @@ func NewEditorInterface() EditorInterface {
 	return &Editor{}
 }
 
-func (d *Editor) EditConfigByPathmapDiff(deviceNameToOrderedmap map[string]orderedmap.OrderedmapInterfaces, deviceNameTodiff map[string]*pathmap.DiffResult) error {
+// EditConfigByPathmapDiff applies the diff to the device configs. Container and list values are applied leaf by leaf
+// so that the parts of the config not managed by a pathmap are kept, unless their operation is replace or delete.
+// Likewise a leaf-list is applied as a set delta from its previous value so that its other elements are kept.
+// The delta is applied to the leaf-list of the running config in deviceNameToRunning, if the device has one,
+// so that the elements added on the device out of band are kept too.
+func (d *Editor) EditConfigByPathmapDiff(deviceNameToOrderedmap map[string]orderedmap.OrderedmapInterfaces, deviceNameTodiff map[string]*pathmap.DiffResult, deviceNameToRunning map[string]orderedmap.OrderedmapInterfaces) error {
 	for deviceName, diffValue := range deviceNameTodiff {
-		createPaths := diffValue.Create.GetKeys()
-		updatePaths := diffValue.Update.GetKeys()
-		deletePaths := diffValue.Delete.GetKeys()
-		for _, v := range createPaths {
-			setPath, _ := diffValue.Create.GetPath(v)
-			setValue, _ := diffValue.Create.GetValue(v)
-			err := deviceNameToOrderedmap[deviceName].RecursiveSet(setPath, setValue)
-			if err != nil {
-				return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
-			}
+		running, ok := deviceNameToRunning[deviceName]
+		if !ok {
+			running = deviceNameToOrderedmap[deviceName]
 		}
-		for _, v := range updatePaths {
-			setPath, _ := diffValue.Update.GetPath(v)
-			setValue, _ := diffValue.Update.GetValue(v)
-			err := deviceNameToOrderedmap[deviceName].RecursiveSet(setPath, setValue)
-			if err != nil {
-				return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
-			}
+		create, err := pathmap.ExpandLeaves(diffValue.Create)
+		if err != nil {
+			return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
 		}
+		update, err := pathmap.ExpandLeaves(diffValue.Update)
+		if err != nil {
+			return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
+		}
+		del, err := pathmap.ExpandLeaves(diffValue.Delete)
+		if err != nil {
+			return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
+		}
+		deletePaths := del.GetKeys()
+		sort.SliceStable(deletePaths, func(i, j int) bool {
+			ki, _ := del.GetPath(deletePaths[i])
+			kj, _ := del.GetPath(deletePaths[j])
+			return !yangpath.IsListKeyLeaf(ki) && yangpath.IsListKeyLeaf(kj)
+		})
+		// deleted first so that a value replaced as a whole is not broken by the deletion of its old leaves
 		for _, v := range deletePaths {
-			setPath, _ := diffValue.Delete.GetPath(v)
+			setPath, _ := del.GetPath(v)
+			option, _ := del.GetOption(v)
+			// dropping a delete directive does not restore the deleted config
+			if pathmap.Operation(option) == pathmap.OPERATION_DELETE {
+				continue
+			}
+			if value, _ := del.GetValue(v); !pathmap.IsAtomic(option) && pathmap.IsLeafList(value) {
+				if err := setLeafList(deviceNameToOrderedmap[deviceName], running, setPath, value, nil, option); err != nil {
+					return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
+				}
+				continue
+			}
 			err := deviceNameToOrderedmap[deviceName].RecursiveDelete(setPath)
 			if err != nil {
 				return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
 			}
 		}
+		for _, setPathmap := range []pathmap.PathMap{create, update} {
+			for _, v := range setPathmap.GetKeys() {
+				if err := apply(deviceNameToOrderedmap[deviceName], running, setPathmap, v, diffValue.Previous); err != nil {
+					return fmt.Errorf("EditConfigByPathmapDiff: %w", err)
+				}
+			}
+		}
 	}
 	return nil
 }
+
+// apply sets the value of path to config, or deletes path for operation=delete.
+// A value with operation=replace overwrites the whole subtree, and a leaf-list is changed from its value in previous.
+func apply(config orderedmap.OrderedmapInterfaces, running orderedmap.OrderedmapInterfaces, pm pathmap.PathMap, path string, previous pathmap.PathMap) error {
+	setPath, _ := pm.GetPath(path)
+	setValue, _ := pm.GetValue(path)
+	option, _ := pm.GetOption(path)
+	if pathmap.Operation(option) == pathmap.OPERATION_DELETE {
+		return config.RecursiveDelete(setPath)
+	}
+	if !pathmap.IsAtomic(option) && pathmap.IsLeafList(setValue) {
+		previousValue, _ := previous.GetValue(path)
+		return setLeafList(config, running, setPath, previousValue, setValue, option)
+	}
+	return config.RecursiveSet(setPath, setValue)
+}
+
+// setLeafList changes the leaf-list at setPath of running from previous to next and sets the result to config.
+// The elements of next are put in the order of next if the leaf-list is ordered by the user.
+// It deletes the leaf-list if next is nil and no element is left.
+func setLeafList(config orderedmap.OrderedmapInterfaces, running orderedmap.OrderedmapInterfaces, setPath []string, previous any, next any, option map[string]string) error {
+	current, _, err := running.RecursiveGet(setPath)
+	if err != nil {
+		return fmt.Errorf("setLeafList: %w", err)
+	}
+	result := pathmap.LeafListDelta(current, previous, next)
+	if pathmap.IsOrderedByUser(option) {
+		result = pathmap.OrderLeafList(result, next)
+	}
+	if len(result) == 0 && next == nil {
+		return config.RecursiveDelete(setPath)
+	}
+	return config.RecursiveSet(setPath, result)
+}
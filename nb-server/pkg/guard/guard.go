@@ -0,0 +1,149 @@
+package guard
+
+import (
+	"fmt"
+	"sort"
+
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+)
+
+// Claim is a path of the brownfield config that no service owned and that a change sets or deletes.
+type Claim struct {
+	Path string `json:"path"`
+	// Value is the brownfield value of the path.
+	Value interface{} `json:"value"`
+	// Services are the services of the change touching the path.
+	Services []string `json:"services,omitempty"`
+}
+
+// Check returns the claims of diffResult on brownfield, the running config of the device stored in actual.json.
+// A leaf of managed, the composed pathmap of the device before the change, is owned, and so is every leaf
+// under a value with operation=replace or delete. Like the editor, a change touches the leaves of its values
+// and, for a value with operation=replace or delete, the whole subtree, but not a leaf-list merged as a set delta.
+// The claims are sorted by path, and options identify the list entries of both brownfield and the pathmaps.
+func Check(brownfield *iomap.OrderedMap, managed pathmap.PathMapInterface, diffResult *pathmap.DiffResult, options diff.TreeOptions) ([]Claim, error) {
+	leaves, err := diff.Leaves(brownfield, options)
+	if err != nil {
+		return nil, fmt.Errorf("Check: %w", err)
+	}
+	listKeys, err := pathmap.LearnListKeys(options.ListKeys, managed, diffResult.Create, diffResult.Update, diffResult.Delete)
+	if err != nil {
+		return nil, fmt.Errorf("Check: %w", err)
+	}
+	owned, err := pathmap.ExpandLeavesWithKeys(managed, listKeys)
+	if err != nil {
+		return nil, fmt.Errorf("Check: %w", err)
+	}
+	claims := make(map[string]*Claim)
+	for _, pm := range []pathmap.PathMap{diffResult.Create, diffResult.Update, diffResult.Delete} {
+		touched, err := pathmap.ExpandLeavesWithKeys(pm, listKeys)
+		if err != nil {
+			return nil, fmt.Errorf("Check: %w", err)
+		}
+		for _, path := range touched.GetKeys() {
+			option, _ := touched.GetOption(path)
+			if value, _ := touched.GetValue(path); !pathmap.IsAtomic(option) && pathmap.IsLeafList(value) {
+				continue
+			}
+			var services []string
+			if provenance, ok := touched.GetProvenance(path); ok {
+				services = provenance.Services
+			}
+			for leafPath, value := range touchedLeaves(leaves, path, pathmap.IsAtomic(option)) {
+				if isOwned(owned, leafPath) {
+					continue
+				}
+				claim, ok := claims[leafPath]
+				if !ok {
+					claim = &Claim{Path: leafPath, Value: value}
+					claims[leafPath] = claim
+				}
+				claim.Services = appendServices(claim.Services, services)
+			}
+		}
+	}
+	result := make([]Claim, 0, len(claims))
+	for _, v := range claims {
+		result = append(result, *v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// ClaimAll returns every leaf of brownfield as a claim of the services of diffResult,
+// for a device whose brownfield config is replaced as a whole. The claims are sorted by path.
+func ClaimAll(brownfield *iomap.OrderedMap, diffResult *pathmap.DiffResult, options diff.TreeOptions) ([]Claim, error) {
+	leaves, err := diff.Leaves(brownfield, options)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimAll: %w", err)
+	}
+	var services []string
+	for _, pm := range []pathmap.PathMap{diffResult.Create, diffResult.Update, diffResult.Delete} {
+		for _, path := range pm.GetKeys() {
+			if provenance, ok := pm.GetProvenance(path); ok {
+				services = appendServices(services, provenance.Services)
+			}
+		}
+	}
+	result := make([]Claim, 0, len(leaves))
+	for path, value := range leaves {
+		result = append(result, Claim{Path: path, Value: value, Services: services})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// touchedLeaves returns the leaves at path and, if subtree is true, under path.
+func touchedLeaves(leaves map[string]interface{}, path string, subtree bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	if value, ok := leaves[path]; ok {
+		result[path] = value
+	}
+	if !subtree {
+		return result
+	}
+	for leafPath, value := range leaves {
+		if yangpath.IsDescendant(leafPath, path) {
+			result[leafPath] = value
+		}
+	}
+	return result
+}
+
+// isOwned reports whether path or one of its ancestors is a path of owned.
+func isOwned(owned pathmap.PathMap, path string) bool {
+	keys, err := yangpath.SplitPath(path)
+	if err != nil {
+		return false
+	}
+	for i := len(keys); i > 0; i-- {
+		if _, ok := owned.GetValue(yangpath.JoinPath(keys[:i])); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func appendServices(list []string, services []string) []string {
+	for _, s := range services {
+		found := false
+		for _, v := range list {
+			if v == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, s)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
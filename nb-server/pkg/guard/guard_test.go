@@ -0,0 +1,143 @@
+package guard
+
+import (
+	"testing"
+
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"github.com/stretchr/testify/assert"
+)
+
+type entry struct {
+	value    any
+	option   map[string]string
+	services []string
+}
+
+func newPathMap(t *testing.T, entries map[string]entry) pathmap.PathMap {
+	result := make(pathmap.PathMap)
+	for path, v := range entries {
+		option := v.option
+		if option == nil {
+			option = make(map[string]string)
+		}
+		assert.Nil(t, result.SetValue(path, v.value, option))
+		if v.services != nil {
+			assert.Nil(t, result.SetProvenance(path, &pathmap.Provenance{Services: v.services}))
+		}
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	brownfield := `{"A":{"mtu":1500,"desc":"legacy","vlans":[10]},"B":[{"name":"b0","v":1},{"name":"b1","v":2}]}`
+	managed := map[string]entry{
+		"/A/mtu":        {value: 1500},
+		"/B[name=b0]/v": {value: 1},
+	}
+	type test struct {
+		create map[string]entry
+		update map[string]entry
+		delete map[string]entry
+		// brownfield overrides the brownfield config of the other cases
+		brownfield string
+		options    diff.TreeOptions
+		want       []Claim
+	}
+	tests := map[string]test{
+		"正常系: 所有されていない既存パスの設定": {
+			create: map[string]entry{"/A/desc": {value: "new", services: []string{"serviceA"}}},
+			want:   []Claim{{Path: "/A/desc", Value: "legacy", Services: []string{"serviceA"}}},
+		},
+		"正常系: 所有されたパスの変更": {
+			update: map[string]entry{"/A/mtu": {value: 9000, services: []string{"serviceA"}}},
+			delete: map[string]entry{"/B[name=b0]/v": {value: 1, services: []string{"serviceB"}}},
+			want:   []Claim{},
+		},
+		"正常系: 既存の設定にないパスの設定": {
+			create: map[string]entry{"/C": {value: "c", services: []string{"serviceA"}}},
+			want:   []Claim{},
+		},
+		"正常系: replaceによるサブツリーの上書き": {
+			create: map[string]entry{"/B": {
+				value:    []interface{}{map[string]interface{}{"name": "b0", "v": 1}},
+				option:   map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_REPLACE},
+				services: []string{"serviceB"},
+			}},
+			want: []Claim{
+				{Path: "/B[name=b0]/name", Value: "b0", Services: []string{"serviceB"}},
+				{Path: "/B[name=b1]/name", Value: "b1", Services: []string{"serviceB"}},
+				{Path: "/B[name=b1]/v", Value: float64(2), Services: []string{"serviceB"}},
+			},
+		},
+		"正常系: リーフリストは管理外の要素を残すので対象外": {
+			create: map[string]entry{"/A/vlans": {value: []int{20}, services: []string{"serviceA"}}},
+			want:   []Claim{},
+		},
+		"正常系: replaceによるリーフリストの上書き": {
+			create: map[string]entry{"/A/vlans": {
+				value:    []int{20},
+				option:   map[string]string{pathmap.OPTION_OPERATION: pathmap.OPERATION_REPLACE},
+				services: []string{"serviceA"},
+			}},
+			want: []Claim{{Path: "/A/vlans", Value: []interface{}{float64(10)}, Services: []string{"serviceA"}}},
+		},
+		"正常系: モデルの複数キーでリストの要素を識別": {
+			brownfield: `{"route":[{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1},{"prefix":"10.0.0.0/8","next-hop":"2.2.2.2","metric":2}]}`,
+			options:    diff.TreeOptions{ListKeys: yangpath.ListKeys{"/route": {"prefix", "next-hop"}}},
+			create: map[string]entry{"/route": {
+				value:    []interface{}{map[string]interface{}{"prefix": "10.0.0.0/8", "next-hop": "2.2.2.2", "metric": 5}},
+				services: []string{"serviceA"},
+			}},
+			want: []Claim{
+				{Path: "/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/metric", Value: float64(2), Services: []string{"serviceA"}},
+				{Path: "/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/next-hop", Value: "2.2.2.2", Services: []string{"serviceA"}},
+				{Path: "/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/prefix", Value: "10.0.0.0/8", Services: []string{"serviceA"}},
+			},
+		},
+		"正常系: 複数サービスによる同じパスの設定": {
+			create: map[string]entry{"/A/desc": {value: "new", services: []string{"serviceB", "serviceA"}}},
+			want:   []Claim{{Path: "/A/desc", Value: "legacy", Services: []string{"serviceA", "serviceB"}}},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			config := brownfield
+			if tt.brownfield != "" {
+				config = tt.brownfield
+			}
+			omap, err := orderedmap.New([]byte(config))
+			assert.Nil(t, err)
+			diffResult := &pathmap.DiffResult{
+				Create: newPathMap(t, tt.create),
+				Update: newPathMap(t, tt.update),
+				Delete: newPathMap(t, tt.delete),
+			}
+			got, err := Check(omap.Value, newPathMap(t, managed), diffResult, tt.options)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClaimAll(t *testing.T) {
+	t.Parallel()
+	omap, err := orderedmap.New([]byte(`{"A":{"mtu":1500},"B":[{"name":"b0"}]}`))
+	assert.Nil(t, err)
+	diffResult := &pathmap.DiffResult{
+		Create: newPathMap(t, map[string]entry{"/C": {value: "c", services: []string{"serviceB"}}}),
+		Update: newPathMap(t, map[string]entry{}),
+		Delete: newPathMap(t, map[string]entry{"/D": {value: "d", services: []string{"serviceA"}}}),
+	}
+	got, err := ClaimAll(omap.Value, diffResult, diff.TreeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []Claim{
+		{Path: "/A/mtu", Value: float64(1500), Services: []string{"serviceA", "serviceB"}},
+		{Path: "/B[name=b0]/name", Value: "b0", Services: []string{"serviceA", "serviceB"}},
+	}, got)
+}
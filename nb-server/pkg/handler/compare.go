@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"github.com/nttcom/ksot/nb-server/pkg/sync"
+)
+
+const (
+	SOURCE_SET        = "set"
+	SOURCE_ACTUAL     = "actual"
+	SOURCE_REMEDIATED = "remediated"
+	SOURCE_RUNNING    = "running"
+)
+
+type deviceDiffResponse struct {
+	Device  string        `json:"device"`
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Path    string        `json:"path"`
+	Changes []diff.Change `json:"changes"`
+}
+
+// runningConfig fetches the running config of deviceName from the device.
+func (h *handler) runningConfig(deviceName string, iface string) (*orderedmap.Orderedmap, error) {
+	syncInterface, ok := sync.SyncInterfaceMap[iface]
+	if !ok {
+		return nil, apierror.New(apierror.CODE_UNSUPPORTED_INTERFACE, "runningConfig: unsupported interface %v", iface).WithDevice(deviceName)
+	}
+	jsonByte, err := syncInterface.SyncDevice(h.sbAPI, h.libyang, deviceName)
+	if err != nil {
+		return nil, sbError(fmt.Errorf("runningConfig: %w", err)).WithDevice(deviceName)
+	}
+	result, err := orderedmap.New(jsonByte)
+	if err != nil {
+		return nil, fmt.Errorf("runningConfig: %w", err)
+	}
+	return result, nil
+}
+
+// deviceListKeys returns the keys of the lists of the models of each device.
+func (h *handler) deviceListKeys(deviceNames []string) (map[string]yangpath.ListKeys, error) {
+	result := make(map[string]yangpath.ListKeys)
+	for _, deviceName := range deviceNames {
+		listKeys, err := h.libyang.ListKeys(deviceName)
+		if err != nil {
+			return nil, apierror.Wrap(apierror.CODE_VALIDATION_FAILED, fmt.Errorf("deviceListKeys: %w", err)).WithDevice(deviceName)
+		}
+		result[deviceName] = listKeys
+	}
+	return result, nil
+}
+
+// deviceConfig returns the config of deviceName named by source: set, actual, remediated or running,
+// or set@<rev>, actual@<rev> and remediated@<rev> for a stored config at the git revision rev.
+func (h *handler) deviceConfig(deviceName string, source string) (orderedmap.OrderedmapInterfaces, error) {
+	name, rev, atRevision := strings.Cut(source, "@")
+	var path string
+	switch name {
+	case SOURCE_SET:
+		path = h.githubAPI.MakePathForDeviceSet(deviceName)
+	case SOURCE_ACTUAL:
+		path = h.githubAPI.MakePathForDeviceActual(deviceName)
+	case SOURCE_REMEDIATED:
+		path = h.githubAPI.MakePathForDeviceRemediated(deviceName)
+	case SOURCE_RUNNING:
+		if atRevision {
+			return nil, apierror.New(apierror.CODE_INVALID_REQUEST, "deviceConfig: noexpected revision of %v", source)
+		}
+		deviceInfos, err := h.sbAPI.GetDeviceInfos()
+		if err != nil {
+			return nil, sbError(fmt.Errorf("deviceConfig: %w", err))
+		}
+		iface, ok := deviceInfos[deviceName]
+		if !ok {
+			return nil, apierror.New(apierror.CODE_NOT_FOUND, "deviceConfig: not found device %v", deviceName).WithDevice(deviceName)
+		}
+		return h.runningConfig(deviceName, iface)
+	default:
+		return nil, apierror.New(apierror.CODE_INVALID_REQUEST, "deviceConfig: noexpected source %v", source)
+	}
+	if atRevision && rev == "" {
+		return nil, apierror.New(apierror.CODE_INVALID_REQUEST, "deviceConfig: empty revision in %v", source)
+	}
+	result, err := h.githubAPI.GetConfigAt(path, rev)
+	if err != nil {
+		return nil, gitError(fmt.Errorf("deviceConfig: %w", err)).WithDevice(deviceName)
+	}
+	return result, nil
+}
+
+// GetDeviceDiff compares two complete configs of a device, by default set.json with the stored actual.json.
+func (h *handler) GetDeviceDiff(c echo.Context) error {
+	deviceName := c.Param("device")
+	from := c.QueryParam("from")
+	if from == "" {
+		from = SOURCE_SET
+	}
+	to := c.QueryParam("to")
+	if to == "" {
+		to = SOURCE_ACTUAL
+	}
+	path, err := queryPath(c)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDeviceDiff: %w", err))
+	}
+	fromConfig, err := h.deviceConfig(deviceName, from)
+	if err != nil {
+		return apierror.From(fmt.Errorf("GetDeviceDiff: %w", err))
+	}
+	toConfig, err := h.deviceConfig(deviceName, to)
+	if err != nil {
+		return apierror.From(fmt.Errorf("GetDeviceDiff: %w", err))
+	}
+	listKeys, err := h.deviceListKeys([]string{deviceName})
+	if err != nil {
+		return apierror.From(fmt.Errorf("GetDeviceDiff: %w", err))
+	}
+	changes, err := diff.DiffTrees(fromConfig.GetValue(), toConfig.GetValue(), diff.TreeOptions{ListKeys: listKeys[deviceName]})
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDeviceDiff: %w", err)).WithDevice(deviceName)
+	}
+	result := deviceDiffResponse{Device: deviceName, From: from, To: to, Path: path, Changes: make([]diff.Change, 0)}
+	for _, v := range changes {
+		if v.Path == path || yangpath.IsDescendant(v.Path, path) {
+			result.Changes = append(result.Changes, v)
+		}
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/drift"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+)
+
+// driftState is the running config and stored set.json of a device with the drift between them.
+type driftState struct {
+	actual   *orderedmap.Orderedmap
+	intended orderedmap.OrderedmapInterfaces
+	report   *drift.Report
+}
+
+// fetchDriftState fetches the running config of deviceName and compares it with the stored set.json.
+func (h *handler) fetchDriftState(deviceName string, iface string) (*driftState, error) {
+	actual, err := h.runningConfig(deviceName, iface)
+	if err != nil {
+		return nil, fmt.Errorf("fetchDriftState: %w", err)
+	}
+	deviceConfigs, err := h.githubAPI.GetDeviceConfigs([]string{deviceName})
+	if err != nil {
+		return nil, gitError(fmt.Errorf("fetchDriftState: %w", err)).WithDevice(deviceName)
+	}
+	deviceRefs, err := h.githubAPI.GetDeviceRefs([]string{deviceName})
+	if err != nil {
+		return nil, gitError(fmt.Errorf("fetchDriftState: %w", err)).WithDevice(deviceName)
+	}
+	listKeys, err := h.deviceListKeys([]string{deviceName})
+	if err != nil {
+		return nil, fmt.Errorf("fetchDriftState: %w", err)
+	}
+	driftInterface := drift.NewDriftInterface()
+	options := diff.TreeOptions{ListKeys: listKeys[deviceName]}
+	return &driftState{
+		actual:   actual,
+		intended: deviceConfigs[deviceName],
+		report:   driftInterface.Detect(deviceName, deviceConfigs[deviceName].GetValue(), actual.GetValue(), deviceRefs[deviceName], options),
+	}, nil
+}
+
+func (h *handler) detectDrift(deviceName string, iface string) (*drift.Report, error) {
+	state, err := h.fetchDriftState(deviceName, iface)
+	if err != nil {
+		return nil, fmt.Errorf("detectDrift: %w", err)
+	}
+	return state.report, nil
+}
+
+func (h *handler) GetDeviceDrift(c echo.Context) error {
+	deviceName := c.Param("device")
+	deviceInfos, err := h.sbAPI.GetDeviceInfos()
+	if err != nil {
+		return sbError(fmt.Errorf("GetDeviceDrift: %w", err))
+	}
+	iface, ok := deviceInfos[deviceName]
+	if !ok {
+		return apierror.New(apierror.CODE_NOT_FOUND, "GetDeviceDrift: not found device %v", deviceName)
+	}
+	report, err := h.detectDrift(deviceName, iface)
+	if err != nil {
+		return apierror.From(fmt.Errorf("GetDeviceDrift: %w", err))
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *handler) GetDrift(c echo.Context) error {
+	deviceInfos, err := h.sbAPI.GetDeviceInfos()
+	if err != nil {
+		return sbError(fmt.Errorf("GetDrift: %w", err))
+	}
+	reports := make([]*drift.Report, 0, len(deviceInfos))
+	for deviceName, iface := range deviceInfos {
+		report, err := h.detectDrift(deviceName, iface)
+		if err != nil {
+			report = &drift.Report{Device: deviceName, Drifts: make([]drift.Drift, 0), Error: err.Error(), CheckedAt: time.Now()}
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Device < reports[j].Device
+	})
+	return c.JSON(http.StatusOK, reports)
+}
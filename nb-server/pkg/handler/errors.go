@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/api"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/configurator"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+)
+
+// HTTPErrorHandler writes every error returned by a handler as an apierror.Error.
+func HTTPErrorHandler(err error, c echo.Context) {
+	var apiErr *apierror.Error
+	var httpErr *echo.HTTPError
+	var status int
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.StatusCode()
+	case errors.As(err, &httpErr):
+		// errors of echo itself such as an unknown route
+		status = httpErr.Code
+		apiErr = apierror.New(codeForStatus(status), "%v", httpErr.Message)
+	default:
+		apiErr = apierror.From(err)
+		status = apiErr.StatusCode()
+	}
+	if c.Response().Committed {
+		return
+	}
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, apiErr)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+func codeForStatus(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return apierror.CODE_NOT_FOUND
+	case status == http.StatusConflict:
+		return apierror.CODE_CONFLICT
+	case status == http.StatusUnsupportedMediaType:
+		return apierror.CODE_UNSUPPORTED_MEDIA_TYPE
+	case status < http.StatusInternalServerError:
+		return apierror.CODE_INVALID_REQUEST
+	default:
+		return apierror.CODE_INTERNAL
+	}
+}
+
+// gitError classifies an error of the github-server. A missing file means the service or device does not exist.
+func gitError(err error) *apierror.Error {
+	var statusErr *api.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return apierror.Wrap(apierror.CODE_NOT_FOUND, err)
+	}
+	return apierror.Wrap(apierror.CODE_GIT_FAILED, err)
+}
+
+// isNotFound reports whether err is a missing file of the github-server.
+func isNotFound(err error) bool {
+	var statusErr *api.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+func sbError(err error) *apierror.Error {
+	return apierror.Wrap(apierror.CODE_SB_UNAVAILABLE, err)
+}
+
+// compositeError returns every conflict of the composite as the details of the error.
+func compositeError(err error) *apierror.Error {
+	result := apierror.Wrap(apierror.CODE_COMPOSITE_CONFLICT, err)
+	var conflictErr *pathmap.ConflictError
+	if errors.As(err, &conflictErr) {
+		result = result.WithDetails(conflictErr)
+	}
+	return result
+}
+
+// configureError classifies an error of Configure with the rollback outcome of the devices configured before it.
+func configureError(err error, results map[string]*configurator.Result) *apierror.Error {
+	rollback := &apierror.Rollback{RolledBackDevices: make([]string, 0), FailedDevices: make([]string, 0)}
+	failedDevice := ""
+	for deviceName, result := range results {
+		if !result.Configured {
+			failedDevice = deviceName
+			continue
+		}
+		rollback.Attempted = true
+		if result.RolledBack {
+			rollback.RolledBackDevices = append(rollback.RolledBackDevices, deviceName)
+		} else {
+			rollback.FailedDevices = append(rollback.FailedDevices, deviceName)
+		}
+	}
+	sort.Strings(rollback.RolledBackDevices)
+	sort.Strings(rollback.FailedDevices)
+	rollback.Succeeded = len(rollback.FailedDevices) == 0
+	code := apierror.CODE_CONFIGURE_FAILED
+	switch {
+	case !rollback.Succeeded:
+		code = apierror.CODE_ROLLBACK_FAILED
+	case errors.Is(err, configurator.ErrUnsupportedInterface):
+		code = apierror.CODE_UNSUPPORTED_INTERFACE
+	}
+	return apierror.Wrap(code, err).WithDevice(failedDevice).WithRollback(rollback)
+}
@@ -1,25 +1,30 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"sort"
+	"time"
 
 	iomap "github.com/iancoleman/orderedmap"
 	"github.com/labstack/echo"
 	"github.com/nttcom/ksot/nb-server/pkg/api"
-	"github.com/nttcom/ksot/nb-server/pkg/composite"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
 	"github.com/nttcom/ksot/nb-server/pkg/config"
-	"github.com/nttcom/ksot/nb-server/pkg/configurator"
-	"github.com/nttcom/ksot/nb-server/pkg/diff"
-	"github.com/nttcom/ksot/nb-server/pkg/editor"
+	"github.com/nttcom/ksot/nb-server/pkg/lock"
+	"github.com/nttcom/ksot/nb-server/pkg/merge"
 	"github.com/nttcom/ksot/nb-server/pkg/model"
 	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
 	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/reconciler"
 	"github.com/nttcom/ksot/nb-server/pkg/sync"
 	"github.com/nttcom/ksot/nb-server/pkg/tf"
+	"github.com/nttcom/ksot/nb-server/pkg/transaction"
+	"github.com/nttcom/ksot/nb-server/pkg/util/jsonpatch"
 	"github.com/nttcom/ksot/nb-server/pkg/util/libyang"
 	"golang.org/x/exp/maps"
 )
@@ -33,38 +38,120 @@ const (
 	JSON_EXTENSION   = ".json"
 )
 
+const (
+	OPERATION_CREATE = "create"
+	OPERATION_UPDATE = "update"
+	OPERATION_DELETE = "delete"
+)
+
+const (
+	MIME_JSON_PATCH  = "application/json-patch+json"
+	MIME_MERGE_PATCH = "application/merge-patch+json"
+)
+
+const (
+	LOCK_POLICY_WAIT   = "wait"
+	LOCK_POLICY_REJECT = "reject"
+)
+
 type handler struct {
-	githubAPI api.GithubApiInterface
-	sbAPI     api.SbApiInterface
-	libyang   libyang.LibyangInterface
-	tfLogic   model.PathMapLogic
+	githubAPI      api.GithubApiInterface
+	sbAPI          api.SbApiInterface
+	libyang        libyang.LibyangInterface
+	tfLogic        model.PathMapLogic
+	serviceOptions model.ServiceOptions
+	transactions   transaction.StoreInterface
+	locks          lock.LockManagerInterface
+	lockPolicy     string
+	lockTimeout    time.Duration
+	reconciler     reconciler.ReconcilerInterface
+	mergePolicy    string
+	// defaultOnboardPolicy is used when a request does not give its onboard policy.
+	defaultOnboardPolicy string
 }
 
-func NewHandler(cfg config.Config) *handler {
-	return &handler{
-		githubAPI: api.NewGithubApi(config.Cfg.GithubServerURL),
-		sbAPI:     api.NewSbApi(config.Cfg.SbServerURL),
-		libyang:   libyang.New(cfg.YangFolderPath, cfg.TemporaryFilePathForLibyang+".xml", cfg.TemporaryFilePathForLibyang+".json"),
-		tfLogic:   tf.TfLogic,
+func NewHandler(cfg config.Config) (*handler, error) {
+	locks, err := lock.New(cfg.LockMode)
+	if err != nil {
+		return nil, fmt.Errorf("NewHandler: %w", err)
+	}
+	if cfg.LockPolicy != LOCK_POLICY_WAIT && cfg.LockPolicy != LOCK_POLICY_REJECT {
+		return nil, fmt.Errorf("NewHandler: noexpected lock policy %v", cfg.LockPolicy)
+	}
+	if cfg.MergePolicy != merge.POLICY_REPLACE && cfg.MergePolicy != merge.POLICY_THREE_WAY {
+		return nil, fmt.Errorf("NewHandler: noexpected merge policy %v", cfg.MergePolicy)
+	}
+	if !isOnboardPolicy(cfg.OnboardPolicy) {
+		return nil, fmt.Errorf("NewHandler: noexpected onboard policy %v", cfg.OnboardPolicy)
+	}
+	h := &handler{
+		githubAPI:            api.NewGithubApi(config.Cfg.GithubServerURL),
+		sbAPI:                api.NewSbApi(config.Cfg.SbServerURL),
+		libyang:              libyang.New(cfg.YangFolderPath, cfg.TemporaryFilePathForLibyang+".xml", cfg.TemporaryFilePathForLibyang+".json"),
+		tfLogic:              tf.TfLogic,
+		serviceOptions:       tf.ServiceOptions,
+		transactions:         transaction.NewStore(cfg.TransactionHistorySize),
+		locks:                locks,
+		lockPolicy:           cfg.LockPolicy,
+		lockTimeout:          time.Duration(cfg.LockWaitTimeout) * time.Second,
+		mergePolicy:          cfg.MergePolicy,
+		defaultOnboardPolicy: cfg.OnboardPolicy,
+	}
+	reconcileConfig := reconciler.Config{
+		Interval:       time.Duration(cfg.ReconcileInterval) * time.Second,
+		Policy:         cfg.ReconcilePolicy,
+		ExcludeDevices: cfg.ReconcileExcludeDevices,
+		MaxConcurrency: cfg.ReconcileMaxConcurrency,
+	}
+	h.reconciler, err = reconciler.New(reconcileConfig, h.sbAPI.GetDeviceInfos, h.reconcileDevice)
+	if err != nil {
+		return nil, fmt.Errorf("NewHandler: %w", err)
 	}
+	return h, nil
 }
 
 func (h *handler) GetService(c echo.Context) error {
 	filePath := c.Param("service")
 	res, err := h.githubAPI.GetServices([]string{filePath})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("GetServices: %v", err))
+		return gitError(fmt.Errorf("GetServices: %w", err)).WithService(filePath)
 	}
 	return c.JSON(http.StatusOK, res[filePath].GetValue().Values())
 }
 
+// GetDevice returns set.json of the device, or actual.json with ?source=actual.
+// With ?path= only the subtree at the path is returned.
 func (h *handler) GetDevice(c echo.Context) error {
 	filePath := c.Param("device")
-	res, err := h.githubAPI.GetDevices([]string{filePath})
+	var res map[string]orderedmap.OrderedmapInterfaces
+	var err error
+	switch source := c.QueryParam("source"); source {
+	case "", "set":
+		res, err = h.githubAPI.GetDevices([]string{filePath})
+	case "actual":
+		res, err = h.githubAPI.GetDeviceActuals([]string{filePath})
+	default:
+		return apierror.New(apierror.CODE_INVALID_REQUEST, "GetDevices: noexpected source %v", source)
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("GetDevices: %v", err))
+		return gitError(fmt.Errorf("GetDevices: %w", err)).WithDevice(filePath)
 	}
-	return c.JSON(http.StatusOK, res[filePath].GetValue().Values())
+	path := c.QueryParam("path")
+	if path == "" || path == "/" {
+		return c.JSON(http.StatusOK, res[filePath].GetValue().Values())
+	}
+	keys, err := pathmap.SplitPath(path)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDevices: %w", err))
+	}
+	value, ok, err := res[filePath].RecursiveGet(keys)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDevices: %w", err))
+	}
+	if !ok {
+		return apierror.New(apierror.CODE_NOT_FOUND, "GetDevices: not found %v on %v", path, filePath).WithDevice(filePath)
+	}
+	return c.JSON(http.StatusOK, value)
 }
 
 func initializeServiceDatas(ga api.GithubApiInterface, serviceNames []string) error {
@@ -79,29 +166,33 @@ func initializeServiceDatas(ga api.GithubApiInterface, serviceNames []string) er
 	return nil
 }
 
-func (h *handler) runTfLogic(serviceMap *orderedmap.Orderedmap, serviceDevicePathmap map[string]map[string]pathmap.PathMapInterface, updateDevices map[string]bool, updateFiles map[string][]byte) error {
+func (h *handler) runTfLogic(serviceMap *orderedmap.Orderedmap, serviceDevicePathmap map[string]map[string]pathmap.PathMapInterface, updateDevices map[string]bool, updateFiles map[string][]byte, newServices bool) error {
 	fmt.Println("runTfLogic check: ", maps.Keys(h.tfLogic), serviceMap)
 	for serviceName, serviceValue := range serviceMap.Value.Values() {
 		serviceValueMap, ok := serviceValue.(iomap.OrderedMap)
 		if !ok {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: Noexpected service model format: %v", serviceValue))
+			return apierror.New(apierror.CODE_INVALID_REQUEST, "runTfLogic: Noexpected service model format: %v", serviceValue).WithService(serviceName)
 		}
 		serviceValueMapByte, err := json.Marshal(serviceValueMap)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
+			return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("runTfLogic: %w", err)).WithService(serviceName)
 		}
 		chekcServiceValidate, err := h.libyang.ValidateJsonForYang(serviceName, serviceValueMapByte)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
+			return apierror.Wrap(apierror.CODE_VALIDATION_FAILED, fmt.Errorf("runTfLogic: %w", err)).WithService(serviceName)
 		}
 		if !chekcServiceValidate {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: failed validate service %v", string(serviceValueMapByte)))
+			return apierror.New(apierror.CODE_VALIDATION_FAILED, "runTfLogic: failed validate service %v", string(serviceValueMapByte)).WithService(serviceName)
 		}
 
 		updateFiles[h.githubAPI.MakePathForServiceInput(serviceName)] = serviceValueMapByte
-		deviceToPathmap, err := h.tfLogic[serviceName](serviceValue)
+		tfLogic, ok := h.tfLogic[serviceName]
+		if !ok {
+			return apierror.New(apierror.CODE_TF_LOGIC_NOT_FOUND, "runTfLogic: not found tf logic of %v", serviceName).WithService(serviceName)
+		}
+		deviceToPathmap, err := tfLogic(serviceValue)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
+			return apierror.Wrap(apierror.CODE_TF_LOGIC_FAILED, fmt.Errorf("runTfLogic: %w", err)).WithService(serviceName)
 		}
 		for deviceName := range deviceToPathmap {
 			updateDevices[deviceName] = true
@@ -112,18 +203,21 @@ func (h *handler) runTfLogic(serviceMap *orderedmap.Orderedmap, serviceDevicePat
 	for serviceName, deviceToPathmap := range serviceDevicePathmap {
 		outputValue := make(map[string]any)
 		for deviceName, pathmapValue := range deviceToPathmap {
-			outputValue[deviceName] = pathmapValue.GetMapInterface()
+			outputValue[deviceName] = pathmapValue.GetStoreMap()
 		}
 		refValueByte, err := json.Marshal(outputValue)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
+			return apierror.Wrap(apierror.CODE_TF_LOGIC_FAILED, fmt.Errorf("runTfLogic: %w", err)).WithService(serviceName)
 		}
 		updateFiles[h.githubAPI.MakePathForServiceOutput(serviceName)] = refValueByte
 	}
 
+	if newServices {
+		return nil
+	}
 	oldServiceRfs, err := h.githubAPI.GetServiceRefs(serviceMap.Value.Keys())
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
+		return gitError(fmt.Errorf("runTfLogic: %w", err))
 	}
 	for serviceName, deviceToPathmap := range oldServiceRfs {
 		for deviceName := range deviceToPathmap {
@@ -131,7 +225,7 @@ func (h *handler) runTfLogic(serviceMap *orderedmap.Orderedmap, serviceDevicePat
 			if !ok {
 				deleteValue, err := pathmap.NewPathMap(make(map[string]interface{}))
 				if err != nil {
-					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
+					return apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("runTfLogic: %w", err))
 				}
 				serviceDevicePathmap[serviceName][deviceName] = deleteValue
 				updateDevices[deviceName] = true
@@ -141,150 +235,156 @@ func (h *handler) runTfLogic(serviceMap *orderedmap.Orderedmap, serviceDevicePat
 	return nil
 }
 
-func (h *handler) runConfigurator(deviceNames []string, serviceDevicePathmap map[string]map[string]pathmap.PathMapInterface, updateFiles map[string][]byte) error {
-	deviceIfs, err := h.sbAPI.GetDeviceInfos()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runConfigurator: %v", err))
-	}
-	deviceConfigs, err := h.githubAPI.GetDeviceConfigs(deviceNames)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("GetDeviceConfigs: %v", err))
-	}
-	rollbackConfigs, err := h.githubAPI.GetDeviceConfigs(deviceNames)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("GetDeviceConfigs: %v", err))
-	}
-	oldDeviceRfs, err := h.githubAPI.GetDeviceRefs(deviceNames)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("GetDeviceRefs: %v", err))
+// planServices runs the TF logic for reqServices and computes the device changes without configuring anything.
+// newServices skips reading the previous service outputs because they do not exist yet.
+// lockedDevices, if not nil, is the set of devices the caller holds locks for.
+// options are the onboard policy and the takeover flag of the request.
+func (h *handler) planServices(tx *transaction.Transaction, reqServices *orderedmap.Orderedmap, newServices bool, lockedDevices map[string]bool, options planOptions) (*plan, map[string][]byte, error) {
+	tx.SetPhase(transaction.PhaseTfLogic)
+	updateFiles := make(map[string][]byte)
+	updateDevices := make(map[string]bool, 0)
+	tfLogicResult := make(map[string]map[string]pathmap.PathMapInterface)
+	if err := h.runTfLogic(reqServices, tfLogicResult, updateDevices, updateFiles, newServices); err != nil {
+		return nil, nil, apierror.Wrap(apierror.CODE_INVALID_REQUEST, err).WithPhase(string(transaction.PhaseTfLogic))
 	}
-	compositeInterface := composite.NewCompositeInterface()
-	oldPathmaps, err := compositeInterface.CompositePathmaps(oldDeviceRfs)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("CompositePathmaps: %v", err))
-	}
-	newDeviceRef, err := compositeInterface.UpdateDeviceRefForComposite(serviceDevicePathmap, oldDeviceRfs)
-	for deviceName, serviceToPathmap := range newDeviceRef {
-		refValue := make(map[string]any)
-		for serviceName, pathmapValue := range serviceToPathmap {
-			if len(pathmapValue.GetMapInterface()) != 0 {
-				refValue[serviceName] = pathmapValue.GetMapInterface()
+	devices := maps.Keys(updateDevices)
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i] < devices[j]
+	})
+	tx.SetDevices(devices)
+	if lockedDevices != nil {
+		for _, deviceName := range devices {
+			if !lockedDevices[deviceName] {
+				return nil, nil, apierror.New(apierror.CODE_CONFLICT, "planServices: device %v changed while waiting for lock, retry", deviceName).WithDevice(deviceName).WithPhase(string(transaction.PhaseTfLogic))
 			}
 		}
-		refValueByte, err := json.Marshal(refValue)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runConfigurator: %v", err))
-		}
-		updateFiles[h.githubAPI.MakePathForDeviceRef(deviceName)] = refValueByte
 	}
+	tx.SetPhase(transaction.PhaseComposite)
+	p, err := h.makePlan(devices, tfLogicResult, updateFiles, options)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runConfigurator: %v", err))
+		return nil, nil, apierror.Wrap(apierror.CODE_INTERNAL, err).WithPhase(string(transaction.PhaseComposite))
 	}
-	newPathmaps, err := compositeInterface.CompositePathmaps(newDeviceRef)
+	tx.SetResolutions(p.resolutions)
+	tx.SetDiffs(p.diffs)
+	tx.SetClaimed(p.claims)
+	return p, updateFiles, nil
+}
+
+func isDryRun(c echo.Context) bool {
+	return c.QueryParam("dryRun") == "true"
+}
+
+func (h *handler) CreateServices(c echo.Context) error {
+	reqByte, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: TfLogic: %v", err))
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("CreateServices: %w", err))
 	}
-	diffInterface := diff.NewDiffInterface()
-	diffResult, err := diffInterface.DiffPathmaps(oldPathmaps, newPathmaps)
+	reqServices, err := orderedmap.New(reqByte)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: TfLogic: %v", err))
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("CreateServices: %w", err))
 	}
-	editorInterface := editor.NewEditorInterface()
-	err = editorInterface.EditConfigByPathmapDiff(deviceConfigs, diffResult)
+	options, err := h.planOptions(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: TfLogic: %v", err))
+		return fmt.Errorf("CreateServices: %w", err)
 	}
-	setBytes := make(map[string][]byte)
-	rollbackBytes := make(map[string][]byte)
-	for k, v := range deviceConfigs {
-		setByte, err := v.MakeByte()
+	if isDryRun(c) {
+		p, _, err := h.planServices(transaction.New(OPERATION_CREATE, reqServices.Value.Keys()), reqServices, true, nil, options)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: TfLogic: %v", err))
+			return apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("CreateServices: %w", err))
 		}
-		updateFiles[h.githubAPI.MakePathForDeviceSet(k)] = setByte
-		chekcJson, setxmlbyte, err := h.libyang.ValidateAndConvertJSONToXML(k, setByte)
-		if !chekcJson || err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: no sync device %v, %v, %v", k, err, chekcJson))
-		}
-		setBytes[k] = setxmlbyte
-		rollbackConfig, ok := rollbackConfigs[k]
-		if !ok {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: no sync device %v", k))
-		}
-		rollbackByte, err := rollbackConfig.MakeByte()
-		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: TfLogic: %v", err))
-		}
-		chekcJson, roolBackxmlbyte, err := h.libyang.ValidateAndConvertJSONToXML(k, rollbackByte)
-		if !chekcJson || err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: no sync device %v, %v, %v", k, err, chekcJson))
-		}
-		rollbackBytes[k] = roolBackxmlbyte
-	}
-	configuratorInterface := configurator.NewConfiguratorInterface(h.sbAPI)
-	if err := configuratorInterface.Configure(deviceIfs, setBytes, rollbackBytes); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: TfLogic: %v", err))
+		return c.JSON(http.StatusOK, p.response())
 	}
-	return nil
+	return h.startTransaction(c, &serviceChange{operation: OPERATION_CREATE, services: reqServices, options: options})
 }
 
-func (h *handler) CreateServices(c echo.Context) error {
+func (h *handler) UpdateServices(c echo.Context) error {
 	reqByte, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("CreateServices: %v", err))
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("UpdateServices: %w", err))
 	}
 	reqServices, err := orderedmap.New(reqByte)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("CreateServices: %v", err))
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("UpdateServices: %w", err))
 	}
-	if err := initializeServiceDatas(h.githubAPI, reqServices.Value.Keys()); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("initializeServiceDatas: %v", err))
+	options, err := h.planOptions(c)
+	if err != nil {
+		return fmt.Errorf("UpdateServices: %w", err)
 	}
-	updateFiles := make(map[string][]byte)
-	updateDevices := make(map[string]bool, 0)
-	tfLogicResult := make(map[string]map[string]pathmap.PathMapInterface)
-	if err := h.runTfLogic(reqServices, tfLogicResult, updateDevices, updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogicsByServiceMap: %v", err))
+	if isDryRun(c) {
+		p, _, err := h.planServices(transaction.New(OPERATION_UPDATE, reqServices.Value.Keys()), reqServices, false, nil, options)
+		if err != nil {
+			return apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("UpdateServices: %w", err))
+		}
+		return c.JSON(http.StatusOK, p.response())
 	}
-	if err := h.runConfigurator(maps.Keys(updateDevices), tfLogicResult, updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runConfigurator: TfLogic: %v", err))
+	return h.startTransaction(c, &serviceChange{operation: OPERATION_UPDATE, services: reqServices, options: options})
+}
+
+// patchService applies a JSON Patch or JSON Merge Patch to the stored input of serviceName.
+func (h *handler) patchService(serviceName string, contentType string, patch []byte) (*orderedmap.Orderedmap, error) {
+	services, err := h.githubAPI.GetServices([]string{serviceName})
+	if err != nil {
+		return nil, gitError(fmt.Errorf("patchService: %w", err)).WithService(serviceName)
+	}
+	current := *services[serviceName].GetValue()
+	var patched any
+	switch contentType {
+	case MIME_JSON_PATCH:
+		patched, err = jsonpatch.ApplyPatch(current, patch)
+	case MIME_MERGE_PATCH, echo.MIMEApplicationJSON:
+		patched, err = jsonpatch.MergePatch(current, patch)
+	default:
+		return nil, fmt.Errorf("patchService: noexpected content type %v", contentType)
 	}
-	if err := h.githubAPI.UpdateFilesForBytes(updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateFilesForBytes: TfLogic: %v", err))
+	if err != nil {
+		return nil, apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("patchService: %w", err)).WithService(serviceName)
 	}
-	response := maps.Keys(updateDevices)
-	sort.Slice(response, func(i, j int) bool {
-		return response[i] < response[j]
-	})
-	return c.JSON(http.StatusOK, response)
+	patchedMap, ok := patched.(iomap.OrderedMap)
+	if !ok {
+		return nil, apierror.New(apierror.CODE_INVALID_REQUEST, "patchService: Noexpected service model format: %v", patched).WithService(serviceName)
+	}
+	reqServices, _ := orderedmap.New([]byte("{}"))
+	reqServices.Value.Set(serviceName, patchedMap)
+	return reqServices, nil
 }
 
-func (h *handler) UpdateServices(c echo.Context) error {
-	reqByte, err := io.ReadAll(c.Request().Body)
+func (h *handler) PatchService(c echo.Context) error {
+	serviceName := c.Param("service")
+	contentType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: %v", err))
+		return apierror.New(apierror.CODE_UNSUPPORTED_MEDIA_TYPE, "PatchService: %v", err)
 	}
-	reqServices, err := orderedmap.New(reqByte)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateServices: %v", err))
+	if contentType != MIME_JSON_PATCH && contentType != MIME_MERGE_PATCH && contentType != echo.MIMEApplicationJSON {
+		return apierror.New(apierror.CODE_UNSUPPORTED_MEDIA_TYPE, "PatchService: noexpected content type %v", contentType)
 	}
-	updateFiles := make(map[string][]byte)
-	updateDevices := make(map[string]bool, 0)
-	tfLogicResult := make(map[string]map[string]pathmap.PathMapInterface)
-	if err := h.runTfLogic(reqServices, tfLogicResult, updateDevices, updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("PatchService: %w", err))
 	}
-	if err := h.runConfigurator(maps.Keys(updateDevices), tfLogicResult, updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runConfigurator: %v", err))
+	reqServices, err := h.patchService(serviceName, contentType, patch)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("PatchService: %w", err))
 	}
-	if err := h.githubAPI.UpdateFilesForBytes(updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateFilesForBytes: %v", err))
+	options, err := h.planOptions(c)
+	if err != nil {
+		return fmt.Errorf("PatchService: %w", err)
 	}
-	response := maps.Keys(updateDevices)
-	sort.Slice(response, func(i, j int) bool {
-		return response[i] < response[j]
+	if isDryRun(c) {
+		p, _, err := h.planServices(transaction.New(OPERATION_UPDATE, reqServices.Value.Keys()), reqServices, false, nil, options)
+		if err != nil {
+			return apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("PatchService: %w", err))
+		}
+		return c.JSON(http.StatusOK, p.response())
+	}
+	// the patch is applied again once the lock is held so that it is never based on a stale input
+	return h.startTransaction(c, &serviceChange{
+		operation: OPERATION_UPDATE,
+		services:  reqServices,
+		options:   options,
+		reload: func() (*orderedmap.Orderedmap, error) {
+			return h.patchService(serviceName, contentType, patch)
+		},
 	})
-	return c.JSON(http.StatusOK, response)
 }
 
 func (h *handler) DeleteServices(c echo.Context) error {
@@ -294,26 +394,18 @@ func (h *handler) DeleteServices(c echo.Context) error {
 	for _, v := range deleteServiceNames {
 		deleteServicesReq.Value.Set(v, *iomap.New())
 	}
-	updateFiles := make(map[string][]byte)
-	updateDevices := make(map[string]bool, 0)
-	tfLogicResult := make(map[string]map[string]pathmap.PathMapInterface)
-	if err := h.runTfLogic(deleteServicesReq, tfLogicResult, updateDevices, updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runTfLogic: %v", err))
-	}
-	if err := h.runConfigurator(maps.Keys(updateDevices), tfLogicResult, updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("runConfigurator: %v", err))
-	}
-	if err := h.githubAPI.UpdateFilesForBytes(updateFiles); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateFilesForBytes: %v", err))
+	options, err := h.planOptions(c)
+	if err != nil {
+		return fmt.Errorf("DeleteServices: %w", err)
 	}
-	if err := h.githubAPI.DeleteServices(deleteServiceNames); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UpdateFilesForBytes: %v", err))
+	if isDryRun(c) {
+		p, _, err := h.planServices(transaction.New(OPERATION_DELETE, deleteServiceNames), deleteServicesReq, false, nil, options)
+		if err != nil {
+			return apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("DeleteServices: %w", err))
+		}
+		return c.JSON(http.StatusOK, p.response())
 	}
-	response := maps.Keys(updateDevices)
-	sort.Slice(response, func(i, j int) bool {
-		return response[i] < response[j]
-	})
-	return c.JSON(http.StatusOK, response)
+	return h.startTransaction(c, &serviceChange{operation: OPERATION_DELETE, services: deleteServicesReq, deleteServiceNames: deleteServiceNames, options: options})
 }
 
 func (h *handler) SyncDevices(c echo.Context) error {
@@ -321,13 +413,24 @@ func (h *handler) SyncDevices(c echo.Context) error {
 	initializeFiles := make(map[string][]byte)
 	deviceInfos, err := h.sbAPI.GetDeviceInfos()
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("SyncDevices: %v", err))
+		return sbError(fmt.Errorf("SyncDevices: %w", err))
+	}
+	lockKeys := make([]string, 0)
+	for deviceName := range deviceInfos {
+		lockKeys = append(lockKeys, lockKeyForDevice(deviceName))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.lockTimeout)
+	defer cancel()
+	release, err := h.locks.Acquire(ctx, lockKeys)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_CONFLICT, fmt.Errorf("SyncDevices: %w", err))
 	}
+	defer release()
 	successList := make([]string, 0)
 	for deviceName, iface := range deviceInfos {
 		jsonByte, err := sync.SyncInterfaceMap[iface].SyncDevice(h.sbAPI, h.libyang, deviceName)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("SyncDevices: fail sync device %v: %v: success devices: %v", deviceName, err, successList))
+			return sbError(fmt.Errorf("SyncDevices: fail sync device %v: %w: success devices: %v", deviceName, err, successList)).WithDevice(deviceName)
 		}
 		updateFiles[h.githubAPI.MakePathForDeviceActual(deviceName)] = jsonByte
 		// TODO diffを実装する場合、ここで差分を確認したい
@@ -338,11 +441,11 @@ func (h *handler) SyncDevices(c echo.Context) error {
 
 	err = h.githubAPI.UpdateFilesForBytes(updateFiles)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("SyncDevices: UpdateFilesForBytes: %v", err))
+		return gitError(fmt.Errorf("SyncDevices: UpdateFilesForBytes: %w", err))
 	}
 	err = h.githubAPI.InitializeFilesForBytes(initializeFiles)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("SyncDevices: InitializeFilesForBytes %v", err))
+		return gitError(fmt.Errorf("SyncDevices: InitializeFilesForBytes %w", err))
 	}
 
 	sort.Slice(successList, func(i, j int) bool {
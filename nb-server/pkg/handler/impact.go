@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/composite"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+)
+
+type ownerItem struct {
+	Service string      `json:"service"`
+	Path    string      `json:"path"`
+	Value   interface{} `json:"value"`
+}
+
+type ownerResponse struct {
+	Device string      `json:"device"`
+	Path   string      `json:"path"`
+	Owners []ownerItem `json:"owners"`
+}
+
+type pathItem struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+	*pathmap.Provenance
+}
+
+type pathsResponse struct {
+	Device string     `json:"device"`
+	Path   string     `json:"path"`
+	Paths  []pathItem `json:"paths"`
+}
+
+// GetServiceDevices returns the pathmap written to each device by the service (output.json).
+func (h *handler) GetServiceDevices(c echo.Context) error {
+	serviceName := c.Param("service")
+	serviceRefs, err := h.githubAPI.GetServiceRefs([]string{serviceName})
+	if err != nil {
+		return gitError(fmt.Errorf("GetServiceDevices: %w", err))
+	}
+	result := make(map[string]map[string]interface{})
+	for deviceName, pm := range serviceRefs[serviceName] {
+		result[deviceName] = pm.GetMapInterface()
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetDeviceServices returns the pathmap of each service owning a part of the device config (ref.json).
+func (h *handler) GetDeviceServices(c echo.Context) error {
+	deviceName := c.Param("device")
+	deviceRefs, err := h.githubAPI.GetDeviceRefs([]string{deviceName})
+	if err != nil {
+		return gitError(fmt.Errorf("GetDeviceServices: %w", err))
+	}
+	result := make(map[string]map[string]interface{})
+	for serviceName, pm := range deviceRefs[deviceName] {
+		result[serviceName] = pm.GetMapInterface()
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetDeviceOwner returns the services owning the config path of the device.
+// A container path matches every leaf under it, and the path may contain * wildcards.
+func (h *handler) GetDeviceOwner(c echo.Context) error {
+	deviceName := c.Param("device")
+	path, err := queryPath(c)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDeviceOwner: %w", err))
+	}
+	deviceRefs, err := h.githubAPI.GetDeviceRefs([]string{deviceName})
+	if err != nil {
+		return gitError(fmt.Errorf("GetDeviceOwner: %w", err))
+	}
+	response := ownerResponse{Device: deviceName, Path: path, Owners: make([]ownerItem, 0)}
+	for serviceName, pm := range deviceRefs[deviceName] {
+		subtree, err := pm.Query(path)
+		if err != nil {
+			return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDeviceOwner: %w", err))
+		}
+		for _, key := range subtree.GetKeys() {
+			value, _ := subtree.GetValue(key)
+			response.Owners = append(response.Owners, ownerItem{Service: serviceName, Path: key, Value: value})
+		}
+	}
+	if len(response.Owners) == 0 {
+		return apierror.New(apierror.CODE_NOT_FOUND, "GetDeviceOwner: not found owner of %v on %v", path, deviceName)
+	}
+	sort.Slice(response.Owners, func(i, j int) bool {
+		if response.Owners[i].Path != response.Owners[j].Path {
+			return response.Owners[i].Path < response.Owners[j].Path
+		}
+		return response.Owners[i].Service < response.Owners[j].Service
+	})
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetDevicePaths returns the composed pathmap of the device under the path, which may contain * wildcards,
+// with the services owning each leaf.
+func (h *handler) GetDevicePaths(c echo.Context) error {
+	deviceName := c.Param("device")
+	path, err := queryPath(c)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDevicePaths: %w", err))
+	}
+	deviceRefs, writeOrders, err := h.githubAPI.GetDeviceRefsWithWriteOrders([]string{deviceName})
+	if err != nil {
+		return gitError(fmt.Errorf("GetDevicePaths: %w", err))
+	}
+	listKeys, err := h.deviceListKeys([]string{deviceName})
+	if err != nil {
+		return apierror.From(fmt.Errorf("GetDevicePaths: %w", err))
+	}
+	deviceToPathmap, _, err := composite.NewCompositeInterface().CompositePathmapsWithResolutions(deviceRefs, composite.Options{
+		ServiceOptions: h.serviceOptions,
+		WriteOrders:    writeOrders,
+		ListKeys:       listKeys,
+	})
+	if err != nil {
+		return compositeError(fmt.Errorf("GetDevicePaths: %w", err))
+	}
+	response := pathsResponse{Device: deviceName, Path: path, Paths: make([]pathItem, 0)}
+	pm, err := deviceToPathmap[deviceName].Query(path)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("GetDevicePaths: %w", err))
+	}
+	for _, key := range pm.GetKeys() {
+		value, _ := pm.GetValue(key)
+		provenance, _ := pm.GetProvenance(key)
+		response.Paths = append(response.Paths, pathItem{Path: key, Value: value, Provenance: provenance})
+	}
+	sort.Slice(response.Paths, func(i, j int) bool {
+		return response.Paths[i].Path < response.Paths[j].Path
+	})
+	return c.JSON(http.StatusOK, response)
+}
+
+// queryPath returns the path query parameter. An empty path is the root.
+func queryPath(c echo.Context) (string, error) {
+	path := c.QueryParam("path")
+	if path == "" || path == "/" {
+		return "/", nil
+	}
+	if _, err := pathmap.SplitPath(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
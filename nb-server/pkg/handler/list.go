@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"golang.org/x/exp/maps"
+)
+
+const DEFAULT_LIST_LIMIT = 100
+
+type serviceListItem struct {
+	Name    string   `json:"name"`
+	Devices []string `json:"devices"`
+}
+
+type deviceListItem struct {
+	Name     string   `json:"name"`
+	Services []string `json:"services"`
+}
+
+type listResponse struct {
+	Total  int           `json:"total"`
+	Offset int           `json:"offset"`
+	Limit  int           `json:"limit"`
+	Items  []interface{} `json:"items"`
+}
+
+// listNames returns the sorted names of the directories under dirPath filtered by prefix and paginated by offset and limit.
+func (h *handler) listNames(c echo.Context, dirPath string) ([]string, *listResponse, error) {
+	offset, limit := 0, DEFAULT_LIST_LIMIT
+	var err error
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, nil, fmt.Errorf("listNames: noexpected offset %v", v)
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, nil, fmt.Errorf("listNames: noexpected limit %v", v)
+		}
+	}
+	prefix := c.QueryParam("prefix")
+	entries, err := h.githubAPI.ListDirectory(dirPath)
+	if err != nil {
+		return nil, nil, gitError(fmt.Errorf("listNames: %w", err))
+	}
+	names := make([]string, 0)
+	for _, v := range entries {
+		if v.IsDir && strings.HasPrefix(v.Name, prefix) {
+			names = append(names, v.Name)
+		}
+	}
+	sort.Strings(names)
+	response := &listResponse{Total: len(names), Offset: offset, Limit: limit, Items: make([]interface{}, 0)}
+	if offset >= len(names) {
+		return []string{}, response, nil
+	}
+	end := offset + limit
+	if end > len(names) {
+		end = len(names)
+	}
+	return names[offset:end], response, nil
+}
+
+func (h *handler) ListServices(c echo.Context) error {
+	names, response, err := h.listNames(c, SERVICE_REPO)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("ListServices: %w", err))
+	}
+	for _, serviceName := range names {
+		// a service without output.json is listed without devices
+		serviceRefs, err := h.githubAPI.GetServiceRefs([]string{serviceName})
+		if err != nil && !isNotFound(err) {
+			return gitError(fmt.Errorf("ListServices: %w", err))
+		}
+		devices := maps.Keys(serviceRefs[serviceName])
+		sort.Strings(devices)
+		response.Items = append(response.Items, serviceListItem{Name: serviceName, Devices: devices})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *handler) ListDevices(c echo.Context) error {
+	names, response, err := h.listNames(c, DEVICES_REPO)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("ListDevices: %w", err))
+	}
+	for _, deviceName := range names {
+		// a device without ref.json is listed without services
+		deviceRefs, err := h.githubAPI.GetDeviceRefs([]string{deviceName})
+		if err != nil && !isNotFound(err) {
+			return gitError(fmt.Errorf("ListDevices: %w", err))
+		}
+		services := maps.Keys(deviceRefs[deviceName])
+		sort.Strings(services)
+		response.Items = append(response.Items, deviceListItem{Name: deviceName, Services: services})
+	}
+	return c.JSON(http.StatusOK, response)
+}
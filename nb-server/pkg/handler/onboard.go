@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/api"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+)
+
+const (
+	// a service cannot touch a device before PUT /sync/devices
+	ONBOARD_POLICY_REJECT = "reject"
+	// the running config of the device is synced within the transaction
+	ONBOARD_POLICY_SYNC = "sync"
+	// the device starts from an empty config so that its running config is replaced by the services
+	ONBOARD_POLICY_INITIALIZE = "initialize"
+)
+
+func isOnboardPolicy(policy string) bool {
+	return policy == ONBOARD_POLICY_REJECT || policy == ONBOARD_POLICY_SYNC || policy == ONBOARD_POLICY_INITIALIZE
+}
+
+// onboardPolicy returns the onboard query parameter, or the configured policy if it is not given.
+func (h *handler) onboardPolicy(c echo.Context) (string, error) {
+	policy := c.QueryParam("onboard")
+	if policy == "" {
+		return h.defaultOnboardPolicy, nil
+	}
+	if !isOnboardPolicy(policy) {
+		return "", apierror.New(apierror.CODE_INVALID_REQUEST, "onboardPolicy: noexpected onboard policy %v", policy)
+	}
+	return policy, nil
+}
+
+// onboarding is the initial state of the devices a transaction touches for the first time.
+type onboarding struct {
+	// configs are the set.json the devices start from.
+	configs map[string]*orderedmap.Orderedmap
+	// running are the running configs the devices are rolled back to.
+	running map[string]*orderedmap.Orderedmap
+	// actualFiles are the running configs to be committed as actual.json.
+	actualFiles map[string][]byte
+	// initialized are the devices whose running config is replaced as a whole.
+	initialized map[string]bool
+}
+
+func (o *onboarding) devices() []string {
+	result := make([]string, 0, len(o.configs))
+	for deviceName := range o.configs {
+		result = append(result, deviceName)
+	}
+	return result
+}
+
+// isSynced reports whether deviceName has set.json and ref.json.
+func (h *handler) isSynced(deviceName string) (bool, error) {
+	entries, err := h.githubAPI.ListDirectory(filepath.Dir(h.githubAPI.MakePathForDeviceRef(deviceName)))
+	var statusErr *api.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("isSynced: %w", err)
+	}
+	files := make(map[string]bool)
+	for _, v := range entries {
+		files[v.Name] = !v.IsDir
+	}
+	return files[filepath.Base(h.githubAPI.MakePathForDeviceRef(deviceName))] && files[filepath.Base(h.githubAPI.MakePathForDeviceSet(deviceName))], nil
+}
+
+// onboardDevices prepares the unsynced devices among deviceNames according to policy.
+func (h *handler) onboardDevices(deviceNames []string, deviceIfs map[string]string, policy string) (*onboarding, error) {
+	result := &onboarding{
+		configs:     make(map[string]*orderedmap.Orderedmap),
+		running:     make(map[string]*orderedmap.Orderedmap),
+		actualFiles: make(map[string][]byte),
+		initialized: make(map[string]bool),
+	}
+	for _, deviceName := range deviceNames {
+		synced, err := h.isSynced(deviceName)
+		if err != nil {
+			return nil, gitError(fmt.Errorf("onboardDevices: %w", err)).WithDevice(deviceName)
+		}
+		if synced {
+			continue
+		}
+		if policy != ONBOARD_POLICY_SYNC && policy != ONBOARD_POLICY_INITIALIZE {
+			return nil, apierror.New(apierror.CODE_DEVICE_NOT_SYNCED, "onboardDevices: not found device %v ref, run sync or onboard it", deviceName).WithDevice(deviceName)
+		}
+		actual, err := h.runningConfig(deviceName, deviceIfs[deviceName])
+		if err != nil {
+			return nil, fmt.Errorf("onboardDevices: %w", err)
+		}
+		actualByte, err := actual.MakeByte()
+		if err != nil {
+			return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("onboardDevices: %w", err)).WithDevice(deviceName)
+		}
+		result.running[deviceName] = actual
+		result.actualFiles[h.githubAPI.MakePathForDeviceActual(deviceName)] = actualByte
+		result.configs[deviceName] = actual
+		if policy == ONBOARD_POLICY_INITIALIZE {
+			result.configs[deviceName], _ = orderedmap.New([]byte("{}"))
+			result.initialized[deviceName] = true
+		}
+	}
+	return result, nil
+}
+
+// deviceConfigs returns set.json of every device in deviceNames twice, the one to be edited and the one
+// to roll back to, with the ref.json and the write order of every device. An onboarded device starts from its onboarding config,
+// is rolled back to its running config and owns no path yet.
+func (o *onboarding) deviceConfigs(ga api.GithubApiInterface, deviceNames []string) (map[string]orderedmap.OrderedmapInterfaces, map[string]orderedmap.OrderedmapInterfaces, map[string]map[string]pathmap.PathMapInterface, map[string][]string, error) {
+	syncedDevices := make([]string, 0)
+	for _, deviceName := range deviceNames {
+		if _, ok := o.configs[deviceName]; !ok {
+			syncedDevices = append(syncedDevices, deviceName)
+		}
+	}
+	deviceConfigs, err := ga.GetDeviceConfigs(syncedDevices)
+	if err != nil {
+		return nil, nil, nil, nil, gitError(fmt.Errorf("GetDeviceConfigs: %w", err))
+	}
+	rollbackConfigs, err := ga.GetDeviceConfigs(syncedDevices)
+	if err != nil {
+		return nil, nil, nil, nil, gitError(fmt.Errorf("GetDeviceConfigs: %w", err))
+	}
+	deviceRefs, writeOrders, err := ga.GetDeviceRefsWithWriteOrders(syncedDevices)
+	if err != nil {
+		return nil, nil, nil, nil, gitError(fmt.Errorf("GetDeviceRefs: %w", err))
+	}
+	for deviceName, config := range o.configs {
+		if deviceConfigs[deviceName], err = copyConfig(config); err != nil {
+			return nil, nil, nil, nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("deviceConfigs: %w", err)).WithDevice(deviceName)
+		}
+		if rollbackConfigs[deviceName], err = copyConfig(o.running[deviceName]); err != nil {
+			return nil, nil, nil, nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("deviceConfigs: %w", err)).WithDevice(deviceName)
+		}
+		deviceRefs[deviceName] = make(map[string]pathmap.PathMapInterface)
+	}
+	return deviceConfigs, rollbackConfigs, deviceRefs, writeOrders, nil
+}
+
+func copyConfig(config *orderedmap.Orderedmap) (*orderedmap.Orderedmap, error) {
+	b, err := config.MakeByte()
+	if err != nil {
+		return nil, fmt.Errorf("copyConfig: %w", err)
+	}
+	return orderedmap.New(b)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/nttcom/ksot/nb-server/pkg/api"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/guard"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"golang.org/x/exp/maps"
+)
+
+// claimUnmanagedPaths returns the claims of diffResult on the brownfield config of each device, which is actual.json
+// or, for an onboarded device, the running config fetched by the onboarding. oldPathmaps are the composed pathmaps before the change.
+// An initialized device claims its whole running config. Any claim refuses the change unless takeover is true.
+func (h *handler) claimUnmanagedPaths(onboarded *onboarding, oldPathmaps map[string]pathmap.PathMapInterface, diffResult map[string]*pathmap.DiffResult, listKeys map[string]yangpath.ListKeys, takeover bool) (map[string][]guard.Claim, error) {
+	deviceNames := maps.Keys(diffResult)
+	sort.Strings(deviceNames)
+	result := make(map[string][]guard.Claim)
+	for _, deviceName := range deviceNames {
+		brownfield, err := h.brownfieldConfig(onboarded, deviceName)
+		if err != nil {
+			return nil, fmt.Errorf("claimUnmanagedPaths: %w", err)
+		}
+		if brownfield == nil {
+			continue
+		}
+		managed, ok := oldPathmaps[deviceName]
+		if !ok {
+			managed = make(pathmap.PathMap)
+		}
+		var claims []guard.Claim
+		options := diff.TreeOptions{ListKeys: listKeys[deviceName]}
+		if onboarded.initialized[deviceName] {
+			claims, err = guard.ClaimAll(brownfield.GetValue(), diffResult[deviceName], options)
+		} else {
+			claims, err = guard.Check(brownfield.GetValue(), managed, diffResult[deviceName], options)
+		}
+		if err != nil {
+			return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("claimUnmanagedPaths: %w", err)).WithDevice(deviceName)
+		}
+		if len(claims) != 0 {
+			result[deviceName] = claims
+		}
+	}
+	if len(result) != 0 && !takeover {
+		devices := maps.Keys(result)
+		sort.Strings(devices)
+		return nil, apierror.New(apierror.CODE_UNMANAGED_CONFIG, "claimUnmanagedPaths: the change overwrites unmanaged config of %v, retry with takeover=true to claim it", devices).
+			WithDetails(result)
+	}
+	return result, nil
+}
+
+// brownfieldConfig returns the brownfield config of deviceName, or nil if the device was synced before actual.json was stored.
+// An onboarded device is compared with its running config even if it starts from an empty config,
+// so that initializing it does not wipe the unmanaged config without a takeover.
+func (h *handler) brownfieldConfig(onboarded *onboarding, deviceName string) (orderedmap.OrderedmapInterfaces, error) {
+	if running, ok := onboarded.running[deviceName]; ok {
+		return running, nil
+	}
+	actuals, err := h.githubAPI.GetDeviceActuals([]string{deviceName})
+	var statusErr *api.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, gitError(fmt.Errorf("brownfieldConfig: %w", err)).WithDevice(deviceName)
+	}
+	return actuals[deviceName], nil
+}
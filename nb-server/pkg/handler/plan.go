@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/api"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/composite"
+	"github.com/nttcom/ksot/nb-server/pkg/configurator"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/editor"
+	"github.com/nttcom/ksot/nb-server/pkg/guard"
+	"github.com/nttcom/ksot/nb-server/pkg/merge"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// planOptions are the options of a service change given by the request.
+type planOptions struct {
+	// onboard is the policy for the devices that have not been synced yet.
+	onboard string
+	// takeover allows the change to claim the unmanaged paths of the brownfield config.
+	takeover bool
+}
+
+// planOptions returns the onboard and takeover query parameters.
+func (h *handler) planOptions(c echo.Context) (planOptions, error) {
+	onboard, err := h.onboardPolicy(c)
+	if err != nil {
+		return planOptions{}, fmt.Errorf("planOptions: %w", err)
+	}
+	return planOptions{onboard: onboard, takeover: c.QueryParam("takeover") == "true"}, nil
+}
+
+// plan holds everything computed for a service change before any device is configured.
+type plan struct {
+	deviceIfs     map[string]string
+	diffResult    map[string]*pathmap.DiffResult
+	resolutions   []pathmap.Resolution
+	deviceConfigs map[string]orderedmap.OrderedmapInterfaces
+	setBytes      map[string][]byte
+	rollbackBytes map[string][]byte
+	// diffs are the reviewable diffs of the set.json of each device.
+	diffs map[string]*diff.Rendering
+	// merges are the out-of-band edits kept by the three-way merge.
+	merges map[string]*merge.Result
+	// onboarded are the devices synced or initialized by the change.
+	onboarded []string
+	// claims are the unmanaged paths of each device taken over by the change.
+	claims map[string][]guard.Claim
+}
+
+type devicePlan struct {
+	Create map[string]interface{} `json:"create"`
+	Update map[string]interface{} `json:"update"`
+	Delete map[string]interface{} `json:"delete"`
+	// Provenance holds the services owning each changed path. A deleted path is owned by its old services.
+	Provenance map[string]*pathmap.Provenance `json:"provenance"`
+	Set        interface{}                    `json:"set"`
+	Xml        string                         `json:"xml"`
+	Diff       *diff.Rendering                `json:"diff"`
+	Merge      *merge.Result                  `json:"merge,omitempty"`
+	Onboarded  bool                           `json:"onboarded,omitempty"`
+	Claimed    []guard.Claim                  `json:"claimed,omitempty"`
+}
+
+type planResponse struct {
+	Devices     map[string]devicePlan `json:"devices"`
+	Resolutions []pathmap.Resolution  `json:"resolutions"`
+}
+
+func (p *plan) response() planResponse {
+	result := planResponse{Devices: make(map[string]devicePlan), Resolutions: p.resolutions}
+	for deviceName, diffValue := range p.diffResult {
+		result.Devices[deviceName] = devicePlan{
+			Create:     diffValue.Create.GetMapInterface(),
+			Update:     diffValue.Update.GetMapInterface(),
+			Delete:     diffValue.Delete.GetMapInterface(),
+			Provenance: diffProvenance(diffValue),
+			Set:        p.deviceConfigs[deviceName].GetValue(),
+			Xml:        string(p.setBytes[deviceName]),
+			Diff:       p.diffs[deviceName],
+			Merge:      p.merges[deviceName],
+			Onboarded:  slices.Contains(p.onboarded, deviceName),
+			Claimed:    p.claims[deviceName],
+		}
+	}
+	return result
+}
+
+// commitMessages returns the commit message of the set.json of each changed device: a summary line,
+// the changed paths, the claimed unmanaged paths and the unified diff.
+func (p *plan) commitMessages(ga api.GithubApiInterface, operation string, services []string) map[string]string {
+	result := make(map[string]string)
+	for deviceName, rendering := range p.diffs {
+		if len(rendering.Changes) == 0 {
+			continue
+		}
+		claimed := ""
+		for _, v := range p.claims[deviceName] {
+			claimed += fmt.Sprintf("claimed %v\n", v.Path)
+		}
+		result[ga.MakePathForDeviceSet(deviceName)] = fmt.Sprintf("%v %v: %v (%v changes)\n\n%v\n%v%v",
+			operation, strings.Join(services, ","), deviceName, len(rendering.Changes), diff.Text(rendering.Changes), claimed, rendering.JSON)
+	}
+	return result
+}
+
+func diffProvenance(diffValue *pathmap.DiffResult) map[string]*pathmap.Provenance {
+	result := make(map[string]*pathmap.Provenance)
+	for _, pm := range []pathmap.PathMap{diffValue.Create, diffValue.Update, diffValue.Delete} {
+		for _, path := range pm.GetKeys() {
+			if provenance, ok := pm.GetProvenance(path); ok {
+				result[path] = provenance
+			}
+		}
+	}
+	return result
+}
+
+// makePlan computes the change of deviceNames. The devices not synced yet are onboarded according to options.onboard,
+// and the unmanaged paths of the brownfield configs are claimed only if options.takeover is true.
+func (h *handler) makePlan(deviceNames []string, serviceDevicePathmap map[string]map[string]pathmap.PathMapInterface, updateFiles map[string][]byte, options planOptions) (*plan, error) {
+	allDeviceIfs, err := h.sbAPI.GetDeviceInfos()
+	if err != nil {
+		return nil, sbError(fmt.Errorf("makePlan: %w", err))
+	}
+	deviceIfs := make(map[string]string)
+	for _, deviceName := range deviceNames {
+		iface, ok := allDeviceIfs[deviceName]
+		if !ok {
+			return nil, apierror.New(apierror.CODE_DEVICE_NOT_SYNCED, "makePlan: not found device %v", deviceName).WithDevice(deviceName)
+		}
+		deviceIfs[deviceName] = iface
+	}
+	listKeys, err := h.deviceListKeys(deviceNames)
+	if err != nil {
+		return nil, fmt.Errorf("makePlan: %w", err)
+	}
+	onboarded, err := h.onboardDevices(deviceNames, deviceIfs, options.onboard)
+	if err != nil {
+		return nil, fmt.Errorf("makePlan: %w", err)
+	}
+	for k, v := range onboarded.actualFiles {
+		updateFiles[k] = v
+	}
+	deviceConfigs, rollbackConfigs, oldDeviceRfs, writeOrders, err := onboarded.deviceConfigs(h.githubAPI, deviceNames)
+	if err != nil {
+		return nil, fmt.Errorf("makePlan: %w", err)
+	}
+	compositeInterface := composite.NewCompositeInterface()
+	oldPathmaps, _, err := compositeInterface.CompositePathmapsWithResolutions(oldDeviceRfs, composite.Options{
+		ServiceOptions: h.serviceOptions,
+		WriteOrders:    writeOrders,
+		ListKeys:       listKeys,
+	})
+	if err != nil {
+		return nil, compositeError(fmt.Errorf("CompositePathmaps: %w", err))
+	}
+	newDeviceRef, err := compositeInterface.UpdateDeviceRefForComposite(serviceDevicePathmap, oldDeviceRfs)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.CODE_DEVICE_NOT_SYNCED, fmt.Errorf("makePlan: %w", err))
+	}
+	latestServices := maps.Keys(serviceDevicePathmap)
+	for deviceName, serviceToPathmap := range newDeviceRef {
+		refValue := make(map[string]any)
+		serviceNames := make([]string, 0)
+		for serviceName, pathmapValue := range serviceToPathmap {
+			if len(pathmapValue.GetMapInterface()) != 0 {
+				refValue[serviceName] = pathmapValue.GetStoreMap()
+				serviceNames = append(serviceNames, serviceName)
+			}
+		}
+		// the write order is stored so that a later change of other services keeps the winners of contested leaves
+		refValue[api.WRITE_ORDER_KEY] = composite.ServiceOrder(serviceNames, writeOrders[deviceName], latestServices)
+		refValueByte, err := json.Marshal(refValue)
+		if err != nil {
+			return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("makePlan: %w", err)).WithDevice(deviceName)
+		}
+		updateFiles[h.githubAPI.MakePathForDeviceRef(deviceName)] = refValueByte
+	}
+	newPathmaps, resolutions, err := compositeInterface.CompositePathmapsWithResolutions(newDeviceRef, composite.Options{
+		ServiceOptions: h.serviceOptions,
+		LatestServices: latestServices,
+		WriteOrders:    writeOrders,
+		ListKeys:       listKeys,
+	})
+	if err != nil {
+		return nil, compositeError(fmt.Errorf("makePlan: TfLogic: %w", err))
+	}
+	diffInterface := diff.NewDiffInterface()
+	diffResult, err := diffInterface.DiffPathmaps(oldPathmaps, newPathmaps)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("makePlan: TfLogic: %w", err))
+	}
+	claims, err := h.claimUnmanagedPaths(onboarded, oldPathmaps, diffResult, listKeys, options.takeover)
+	if err != nil {
+		return nil, fmt.Errorf("makePlan: %w", err)
+	}
+	leafListConfigs, err := h.leafListRunningConfigs(onboarded, deviceIfs, diffResult)
+	if err != nil {
+		return nil, fmt.Errorf("makePlan: %w", err)
+	}
+	editorInterface := editor.NewEditorInterface()
+	err = editorInterface.EditConfigByPathmapDiff(deviceConfigs, diffResult, leafListConfigs)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.CODE_TF_LOGIC_FAILED, fmt.Errorf("makePlan: TfLogic: %w", err))
+	}
+	merges, actualConfigs, err := h.mergeOutOfBandEdits(deviceIfs, rollbackConfigs, deviceConfigs, oldDeviceRfs, newDeviceRef, listKeys)
+	if err != nil {
+		return nil, fmt.Errorf("makePlan: %w", err)
+	}
+	setBytes := make(map[string][]byte)
+	rollbackBytes := make(map[string][]byte)
+	diffs := make(map[string]*diff.Rendering)
+	for k, v := range deviceConfigs {
+		setByte, err := v.MakeByte()
+		if err != nil {
+			return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("makePlan: TfLogic: %w", err)).WithDevice(k)
+		}
+		updateFiles[h.githubAPI.MakePathForDeviceSet(k)] = setByte
+		chekcJson, setxmlbyte, err := h.libyang.ValidateAndConvertJSONToXML(k, setByte)
+		if !chekcJson || err != nil {
+			return nil, apierror.New(apierror.CODE_VALIDATION_FAILED, "makePlan: no sync device %v, %v, %v", k, err, chekcJson).WithDevice(k)
+		}
+		setBytes[k] = setxmlbyte
+		rollbackConfig, ok := rollbackConfigs[k]
+		if !ok {
+			return nil, apierror.New(apierror.CODE_DEVICE_NOT_SYNCED, "makePlan: no sync device %v", k).WithDevice(k)
+		}
+		rollbackByte, err := rollbackConfig.MakeByte()
+		if err != nil {
+			return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("makePlan: TfLogic: %w", err)).WithDevice(k)
+		}
+		chekcJson, roolBackxmlbyte, err := h.libyang.ValidateAndConvertJSONToXML(k, rollbackByte)
+		if !chekcJson || err != nil {
+			return nil, apierror.New(apierror.CODE_DEVICE_NOT_SYNCED, "makePlan: no sync device %v, %v, %v", k, err, chekcJson).WithDevice(k)
+		}
+		rollbackBytes[k] = roolBackxmlbyte
+		// a device is rolled back to its running config, which differs from set.json by the kept out-of-band edits
+		if actual, ok := actualConfigs[k]; ok {
+			actualByte, err := actual.MakeByte()
+			if err != nil {
+				return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("makePlan: %w", err)).WithDevice(k)
+			}
+			chekcJson, actualXmlByte, err := h.libyang.ValidateAndConvertJSONToXML(k, actualByte)
+			if !chekcJson || err != nil {
+				return nil, apierror.New(apierror.CODE_DEVICE_NOT_SYNCED, "makePlan: invalid running config of %v, %v, %v", k, err, chekcJson).WithDevice(k)
+			}
+			rollbackBytes[k] = actualXmlByte
+		}
+		diffs[k], err = diff.Render(h.githubAPI.MakePathForDeviceSet(k), rollbackByte, setByte, roolBackxmlbyte, setxmlbyte, diff.TreeOptions{ListKeys: listKeys[k]})
+		if err != nil {
+			return nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("makePlan: %w", err)).WithDevice(k)
+		}
+	}
+	return &plan{
+		deviceIfs:     deviceIfs,
+		diffResult:    diffResult,
+		resolutions:   resolutions,
+		deviceConfigs: deviceConfigs,
+		setBytes:      setBytes,
+		rollbackBytes: rollbackBytes,
+		diffs:         diffs,
+		merges:        merges,
+		onboarded:     onboarded.devices(),
+		claims:        claims,
+	}, nil
+}
+
+// leafListRunningConfigs returns the running configs of the devices whose diffResult changes a leaf-list as a set delta,
+// so that the editor keeps the elements added on the device out of band under the replace merge policy.
+// The three-way merge policy keeps them by merging the out-of-band edits instead,
+// and an onboarded device already starts from its running config or replaces it as a whole.
+func (h *handler) leafListRunningConfigs(onboarded *onboarding, deviceIfs map[string]string, diffResult map[string]*pathmap.DiffResult) (map[string]orderedmap.OrderedmapInterfaces, error) {
+	result := make(map[string]orderedmap.OrderedmapInterfaces)
+	if h.mergePolicy == merge.POLICY_THREE_WAY {
+		return result, nil
+	}
+	for deviceName, d := range diffResult {
+		if _, ok := onboarded.configs[deviceName]; ok || !changesLeafList(d) {
+			continue
+		}
+		running, err := h.runningConfig(deviceName, deviceIfs[deviceName])
+		if err != nil {
+			return nil, fmt.Errorf("leafListRunningConfigs: %w", err)
+		}
+		result[deviceName] = running
+	}
+	return result, nil
+}
+
+// changesLeafList reports whether d changes a leaf-list that is not replaced as a whole.
+func changesLeafList(d *pathmap.DiffResult) bool {
+	for _, pm := range []pathmap.PathMap{d.Create, d.Update, d.Delete} {
+		for _, path := range pm.GetKeys() {
+			value, _ := pm.GetValue(path)
+			option, _ := pm.GetOption(path)
+			if !pathmap.IsAtomic(option) && pathmap.IsLeafList(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeOutOfBandEdits merges the out-of-band edits of each device into deviceConfigs with the three-way merge policy
+// and returns the merge results with the running configs. baseConfigs are the set.json pushed last,
+// and the paths of oldDeviceRefs and newDeviceRefs are owned.
+func (h *handler) mergeOutOfBandEdits(deviceIfs map[string]string, baseConfigs map[string]orderedmap.OrderedmapInterfaces, deviceConfigs map[string]orderedmap.OrderedmapInterfaces, oldDeviceRefs map[string]map[string]pathmap.PathMapInterface, newDeviceRefs map[string]map[string]pathmap.PathMapInterface, listKeys map[string]yangpath.ListKeys) (map[string]*merge.Result, map[string]orderedmap.OrderedmapInterfaces, error) {
+	merges := make(map[string]*merge.Result)
+	actualConfigs := make(map[string]orderedmap.OrderedmapInterfaces)
+	if h.mergePolicy != merge.POLICY_THREE_WAY {
+		return merges, actualConfigs, nil
+	}
+	for deviceName, intended := range deviceConfigs {
+		base, ok := baseConfigs[deviceName]
+		if !ok {
+			return nil, nil, apierror.New(apierror.CODE_DEVICE_NOT_SYNCED, "mergeOutOfBandEdits: no sync device %v", deviceName).WithDevice(deviceName)
+		}
+		actual, err := h.runningConfig(deviceName, deviceIfs[deviceName])
+		if err != nil {
+			return nil, nil, fmt.Errorf("mergeOutOfBandEdits: %w", err)
+		}
+		owners, err := pathmap.NewOwners(listKeys[deviceName], oldDeviceRefs[deviceName], newDeviceRefs[deviceName])
+		if err != nil {
+			return nil, nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("mergeOutOfBandEdits: %w", err)).WithDevice(deviceName)
+		}
+		result, err := merge.Merge(base, actual, intended, owners, diff.TreeOptions{ListKeys: listKeys[deviceName]})
+		if err != nil {
+			return nil, nil, apierror.Wrap(apierror.CODE_INTERNAL, fmt.Errorf("mergeOutOfBandEdits: %w", err)).WithDevice(deviceName)
+		}
+		if len(result.Conflicts) != 0 {
+			return nil, nil, apierror.New(apierror.CODE_OUT_OF_BAND_CONFLICT, "mergeOutOfBandEdits: out-of-band edits of %v conflict with the change", deviceName).
+				WithDevice(deviceName).WithDetails(result.Conflicts)
+		}
+		merges[deviceName] = result
+		actualConfigs[deviceName] = actual
+	}
+	return merges, actualConfigs, nil
+}
+
+func (h *handler) runConfigurator(p *plan) (map[string]*configurator.Result, error) {
+	configuratorInterface := configurator.NewConfiguratorInterface(h.sbAPI)
+	results, err := configuratorInterface.Configure(p.deviceIfs, p.setBytes, p.rollbackBytes)
+	if err != nil {
+		return results, configureError(fmt.Errorf("runConfigurator: %w", err), results)
+	}
+	return results, nil
+}
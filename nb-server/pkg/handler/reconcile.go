@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/configurator"
+	"github.com/nttcom/ksot/nb-server/pkg/drift"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/reconciler"
+)
+
+// RunReconciler runs the periodic reconciliation until ctx is done.
+func (h *handler) RunReconciler(ctx context.Context) {
+	h.reconciler.Run(ctx)
+}
+
+// reconcileDevice detects the drift of deviceName and remediates it according to policy.
+// Devices locked by a running transaction are skipped until the next round.
+func (h *handler) reconcileDevice(deviceName string, iface string, policy string) *reconciler.Result {
+	result := &reconciler.Result{Device: deviceName, Policy: policy, ReconciledAt: time.Now()}
+	release, err := h.locks.TryAcquire([]string{lockKeyForDevice(deviceName)})
+	if err != nil {
+		result.Skipped = reconciler.SKIPPED_BUSY
+		return result
+	}
+	defer release()
+	state, err := h.fetchDriftState(deviceName, iface)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Report = state.report
+	if state.report.Error != "" {
+		result.Error = state.report.Error
+		return result
+	}
+	if policy == reconciler.POLICY_REPORT || state.report.InSync {
+		return result
+	}
+	paths, accepted, err := h.remediate(deviceName, iface, policy, state)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Remediated = len(paths) != 0
+	result.RemediatedPaths = paths
+	result.AcceptedPaths = accepted
+	return result
+}
+
+// remediate pushes the intended config to deviceName and returns the remediated paths and the accepted paths.
+// With POLICY_REMEDIATE_OWNED only the drifted paths owned by a service are restored, and the other drifted paths
+// are kept on the device and returned as accepted. They are not written into set.json.
+// The pushed config is stored in remediated.json, as actual.json stays the snapshot of the last sync.
+func (h *handler) remediate(deviceName string, iface string, policy string, state *driftState) ([]string, []string, error) {
+	actualByte, err := state.actual.MakeByte()
+	if err != nil {
+		return nil, nil, fmt.Errorf("remediate: %w", err)
+	}
+	target := state.intended
+	paths := make([]string, 0)
+	accepted := make([]string, 0)
+	if policy == reconciler.POLICY_REMEDIATE_OWNED {
+		target = state.actual
+		for _, v := range state.report.Drifts {
+			if !v.Owned {
+				accepted = append(accepted, v.Path)
+				continue
+			}
+			keys, err := pathmap.SplitPath(v.Path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("remediate: %w", err)
+			}
+			if v.Type == drift.TYPE_ADDED {
+				err = target.RecursiveDelete(keys)
+			} else {
+				err = target.RecursiveSet(keys, v.Expected)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("remediate: %w", err)
+			}
+			paths = append(paths, v.Path)
+		}
+		if len(paths) == 0 {
+			return paths, accepted, nil
+		}
+	} else {
+		for _, v := range state.report.Drifts {
+			paths = append(paths, v.Path)
+		}
+	}
+	targetByte, err := target.MakeByte()
+	if err != nil {
+		return nil, nil, fmt.Errorf("remediate: %w", err)
+	}
+	checkJson, targetXml, err := h.libyang.ValidateAndConvertJSONToXML(deviceName, targetByte)
+	if !checkJson || err != nil {
+		return nil, nil, fmt.Errorf("remediate: %v, %v", err, checkJson)
+	}
+	checkJson, actualXml, err := h.libyang.ValidateAndConvertJSONToXML(deviceName, actualByte)
+	if !checkJson || err != nil {
+		return nil, nil, fmt.Errorf("remediate: %v, %v", err, checkJson)
+	}
+	configuratorInterface := configurator.NewConfiguratorInterface(h.sbAPI)
+	_, err = configuratorInterface.Configure(map[string]string{deviceName: iface}, map[string][]byte{deviceName: targetXml}, map[string][]byte{deviceName: actualXml})
+	if err != nil {
+		return nil, nil, fmt.Errorf("remediate: %w", err)
+	}
+	if err := h.githubAPI.UpdateFilesForBytes(map[string][]byte{h.githubAPI.MakePathForDeviceRemediated(deviceName): targetByte}); err != nil {
+		return nil, nil, fmt.Errorf("remediate: %w", err)
+	}
+	return paths, accepted, nil
+}
+
+func (h *handler) GetReconciliations(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.reconciler.Results())
+}
+
+func (h *handler) RunReconciliation(c echo.Context) error {
+	results, err := h.reconciler.RunOnce()
+	if err != nil {
+		return sbError(fmt.Errorf("RunReconciliation: %w", err))
+	}
+	return c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/configurator"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/transaction"
+)
+
+// serviceChange is the request of a single service transaction.
+type serviceChange struct {
+	operation          string
+	services           *orderedmap.Orderedmap
+	deleteServiceNames []string
+	options            planOptions
+	// reload, if set, rebuilds services once the transaction holds its locks.
+	reload func() (*orderedmap.Orderedmap, error)
+}
+
+// startTransaction registers a transaction for the service change and runs it in the background.
+func (h *handler) startTransaction(c echo.Context, change *serviceChange) error {
+	lockKeys, lockedDevices, err := h.lockKeys(change.services, change.operation == OPERATION_CREATE)
+	if err != nil {
+		return apierror.Wrap(apierror.CODE_INVALID_REQUEST, fmt.Errorf("startTransaction: %w", err))
+	}
+	var release func()
+	if h.lockPolicy == LOCK_POLICY_REJECT {
+		release, err = h.locks.TryAcquire(lockKeys)
+		if err != nil {
+			return apierror.Wrap(apierror.CODE_CONFLICT, fmt.Errorf("startTransaction: %w", err))
+		}
+	}
+	tx := h.transactions.Create(change.operation, change.services.Value.Keys())
+	go h.runTransaction(tx, change, lockKeys, lockedDevices, release)
+	c.Response().Header().Set(echo.HeaderLocation, "/transactions/"+tx.ID)
+	return c.JSON(http.StatusAccepted, tx.Snapshot())
+}
+
+func lockKeyForService(serviceName string) string {
+	return "service/" + serviceName
+}
+
+func lockKeyForDevice(deviceName string) string {
+	return "device/" + deviceName
+}
+
+// lockKeys returns the lock keys of the services in reqServices and of every device they touch now or touched before.
+// The devices are computed without holding the lock, so the transaction checks them again once the lock is held.
+func (h *handler) lockKeys(reqServices *orderedmap.Orderedmap, newServices bool) ([]string, map[string]bool, error) {
+	updateDevices := make(map[string]bool, 0)
+	err := h.runTfLogic(reqServices, make(map[string]map[string]pathmap.PathMapInterface), updateDevices, make(map[string][]byte), newServices)
+	if err != nil {
+		return nil, nil, fmt.Errorf("lockKeys: %w", err)
+	}
+	keys := make([]string, 0)
+	for _, serviceName := range reqServices.Value.Keys() {
+		keys = append(keys, lockKeyForService(serviceName))
+	}
+	for deviceName := range updateDevices {
+		keys = append(keys, lockKeyForDevice(deviceName))
+	}
+	return keys, updateDevices, nil
+}
+
+func (h *handler) runTransaction(tx *transaction.Transaction, change *serviceChange, lockKeys []string, lockedDevices map[string]bool, release func()) {
+	if release == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), h.lockTimeout)
+		defer cancel()
+		var err error
+		release, err = h.locks.Acquire(ctx, lockKeys)
+		if err != nil {
+			tx.Fail(apierror.Wrap(apierror.CODE_CONFLICT, fmt.Errorf("runTransaction: %w", err)))
+			return
+		}
+	}
+	defer release()
+	if err := h.executeTransaction(tx, change, lockedDevices); err != nil {
+		tx.Fail(err)
+		return
+	}
+	tx.Succeed()
+}
+
+func (h *handler) executeTransaction(tx *transaction.Transaction, change *serviceChange, lockedDevices map[string]bool) error {
+	reqServices := change.services
+	if change.reload != nil {
+		var err error
+		reqServices, err = change.reload()
+		if err != nil {
+			return fmt.Errorf("executeTransaction: %w", err)
+		}
+	}
+	newServices := tx.Operation == OPERATION_CREATE
+	if newServices {
+		tx.SetPhase(transaction.PhaseTfLogic)
+		if err := initializeServiceDatas(h.githubAPI, reqServices.Value.Keys()); err != nil {
+			return gitError(fmt.Errorf("initializeServiceDatas: %w", err))
+		}
+	}
+	p, updateFiles, err := h.planServices(tx, reqServices, newServices, lockedDevices, change.options)
+	if err != nil {
+		return err
+	}
+	tx.SetPhase(transaction.PhaseConfigure)
+	results, err := h.runConfigurator(p)
+	setDeviceResults(tx, results)
+	if err != nil {
+		return err
+	}
+	tx.SetPhase(transaction.PhaseCommit)
+	if err := h.githubAPI.UpdateFilesWithMessages(updateFiles, p.commitMessages(h.githubAPI, tx.Operation, tx.Services)); err != nil {
+		return gitError(fmt.Errorf("UpdateFilesWithMessages: %w", err))
+	}
+	if tx.Operation == OPERATION_DELETE {
+		if err := h.githubAPI.DeleteServices(change.deleteServiceNames); err != nil {
+			return gitError(fmt.Errorf("DeleteServices: %w", err))
+		}
+	}
+	for deviceName := range results {
+		tx.SetDeviceResult(deviceName, transaction.DeviceResult{Status: transaction.DeviceStatusCommitted})
+	}
+	return nil
+}
+
+func setDeviceResults(tx *transaction.Transaction, results map[string]*configurator.Result) {
+	for deviceName, result := range results {
+		deviceResult := transaction.DeviceResult{Error: result.Error}
+		switch {
+		case result.RolledBack:
+			deviceResult.Status = transaction.DeviceStatusRolledBack
+		case result.Error != "":
+			deviceResult.Status = transaction.DeviceStatusFailed
+		default:
+			deviceResult.Status = transaction.DeviceStatusConfigured
+		}
+		tx.SetDeviceResult(deviceName, deviceResult)
+	}
+}
+
+func (h *handler) GetTransaction(c echo.Context) error {
+	id := c.Param("id")
+	tx, ok := h.transactions.Get(id)
+	if !ok {
+		return apierror.New(apierror.CODE_NOT_FOUND, "GetTransaction: not found transaction %v", id)
+	}
+	return c.JSON(http.StatusOK, tx)
+}
+
+func (h *handler) ListTransactions(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.transactions.List())
+}
@@ -0,0 +1,163 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	MODE_DEVICE = "device"
+	MODE_GLOBAL = "global"
+
+	globalKey = "*"
+)
+
+var ErrConflict = errors.New("lock conflict")
+
+type LockManagerInterface interface {
+	// Acquire waits in queue until every key is free or ctx is done.
+	Acquire(ctx context.Context, keys []string) (func(), error)
+	// TryAcquire fails immediately with ErrConflict if any key is held or queued.
+	TryAcquire(keys []string) (func(), error)
+}
+
+type waiter struct {
+	keys  []string
+	ready chan struct{}
+}
+
+// LockManager serializes holders of overlapping keys in FIFO order.
+// In global mode every holder conflicts with every other holder.
+type LockManager struct {
+	mu     sync.Mutex
+	global bool
+	held   map[string]bool
+	queue  []*waiter
+}
+
+var _ LockManagerInterface = (*LockManager)(nil)
+
+func New(mode string) (*LockManager, error) {
+	switch mode {
+	case MODE_DEVICE, "":
+		return &LockManager{held: make(map[string]bool)}, nil
+	case MODE_GLOBAL:
+		return &LockManager{global: true, held: make(map[string]bool)}, nil
+	default:
+		return nil, fmt.Errorf("New: noexpected lock mode %v", mode)
+	}
+}
+
+func (l *LockManager) normalizeKeys(keys []string) []string {
+	if l.global {
+		return []string{globalKey}
+	}
+	check := make(map[string]bool)
+	result := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if check[k] {
+			continue
+		}
+		check[k] = true
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (l *LockManager) Acquire(ctx context.Context, keys []string) (func(), error) {
+	w := &waiter{keys: l.normalizeKeys(keys), ready: make(chan struct{})}
+	l.mu.Lock()
+	l.queue = append(l.queue, w)
+	l.dispatch()
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaseFunc(w.keys), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			return l.releaseFunc(w.keys), nil
+		default:
+		}
+		for i, v := range l.queue {
+			if v == w {
+				l.queue = append(l.queue[:i], l.queue[i+1:]...)
+				break
+			}
+		}
+		l.dispatch()
+		return nil, fmt.Errorf("Acquire: %w: %v: %v", ErrConflict, w.keys, ctx.Err())
+	}
+}
+
+func (l *LockManager) TryAcquire(keys []string) (func(), error) {
+	keys = l.normalizeKeys(keys)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	busy := make(map[string]bool)
+	for k := range l.held {
+		busy[k] = true
+	}
+	for _, w := range l.queue {
+		for _, k := range w.keys {
+			busy[k] = true
+		}
+	}
+	for _, k := range keys {
+		if busy[k] {
+			return nil, fmt.Errorf("TryAcquire: %w: %v", ErrConflict, k)
+		}
+	}
+	for _, k := range keys {
+		l.held[k] = true
+	}
+	return l.releaseFunc(keys), nil
+}
+
+func (l *LockManager) releaseFunc(keys []string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, k := range keys {
+				delete(l.held, k)
+			}
+			l.dispatch()
+		})
+	}
+}
+
+// dispatch grants queued waiters in order. A waiter never overtakes an earlier waiter it overlaps with.
+func (l *LockManager) dispatch() {
+	blocked := make(map[string]bool)
+	remaining := make([]*waiter, 0, len(l.queue))
+	for _, w := range l.queue {
+		free := true
+		for _, k := range w.keys {
+			if l.held[k] || blocked[k] {
+				free = false
+				break
+			}
+		}
+		if !free {
+			for _, k := range w.keys {
+				blocked[k] = true
+			}
+			remaining = append(remaining, w)
+			continue
+		}
+		for _, k := range w.keys {
+			l.held[k] = true
+		}
+		close(w.ready)
+	}
+	l.queue = remaining
+}
@@ -0,0 +1,83 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryAcquire(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		mode    string
+		held    []string
+		keys    []string
+		wantErr error
+	}
+	tests := map[string]test{
+		"正常系: 重複しないキー":         {mode: MODE_DEVICE, held: []string{"device/A"}, keys: []string{"device/B"}, wantErr: nil},
+		"異常系: 重複するキー":          {mode: MODE_DEVICE, held: []string{"device/A"}, keys: []string{"device/B", "device/A"}, wantErr: ErrConflict},
+		"異常系: globalモードでは常に競合": {mode: MODE_GLOBAL, held: []string{"device/A"}, keys: []string{"device/B"}, wantErr: ErrConflict},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			l, err := New(tt.mode)
+			assert.Nil(t, err)
+			release, err := l.TryAcquire(tt.held)
+			assert.Nil(t, err)
+			release2, err := l.TryAcquire(tt.keys)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+				release()
+				release2, err = l.TryAcquire(tt.keys)
+			}
+			assert.Nil(t, err)
+			release2()
+		})
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+	l, err := New(MODE_DEVICE)
+	assert.Nil(t, err)
+	release, err := l.Acquire(context.Background(), []string{"device/A"})
+	assert.Nil(t, err)
+
+	// overlapping holder times out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx, []string{"device/A", "device/B"})
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	// non overlapping holder runs in parallel
+	releaseB, err := l.Acquire(context.Background(), []string{"device/B"})
+	assert.Nil(t, err)
+	releaseB()
+
+	// queued holder is granted after release
+	granted := make(chan struct{})
+	go func() {
+		r, err := l.Acquire(context.Background(), []string{"device/A"})
+		assert.Nil(t, err)
+		r()
+		close(granted)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-granted:
+		t.Fatal("lock was granted while held")
+	default:
+	}
+	release()
+	select {
+	case <-granted:
+	case <-time.After(time.Second):
+		t.Fatal("lock was not granted after release")
+	}
+}
@@ -0,0 +1,189 @@
+package merge
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+)
+
+const (
+	// the intended config replaces the running config as it is
+	POLICY_REPLACE = "replace"
+	// out-of-band edits of unowned paths are kept and edits of owned paths block the change
+	POLICY_THREE_WAY = "three-way"
+)
+
+// Conflict is an out-of-band edit that cannot be kept.
+type Conflict struct {
+	Path string `json:"path"`
+	// Type is the type of the out-of-band edit from the last pushed config to the running config.
+	Type     string      `json:"type"`
+	Base     interface{} `json:"base,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+	Intended interface{} `json:"intended,omitempty"`
+	// Services own the path. It is empty if the path is changed by both the edit and the intended config.
+	Services []string `json:"services,omitempty"`
+}
+
+type Result struct {
+	// Kept are the out-of-band edits applied to the intended config.
+	Kept      []diff.Change `json:"kept"`
+	Conflicts []Conflict    `json:"conflicts"`
+}
+
+// Merge merges the out-of-band edits from base, the config pushed last, to actual, the running config,
+// into intended. An edit is kept if its path is not owned and intended does not change it differently,
+// otherwise it is a conflict. An edit of a leaf-list is merged as a set delta like the editor changes a leaf-list:
+// its added elements are kept, and removing an element intended still has is a conflict only if the leaf-list is owned.
+// intended is changed only if there is no conflict.
+func Merge(base orderedmap.OrderedmapInterfaces, actual orderedmap.OrderedmapInterfaces, intended orderedmap.OrderedmapInterfaces, owners pathmap.Owners, options diff.TreeOptions) (*Result, error) {
+	edits, err := diff.DiffTrees(base.GetValue(), actual.GetValue(), options)
+	if err != nil {
+		return nil, fmt.Errorf("Merge: %w", err)
+	}
+	changes, err := diff.DiffTrees(base.GetValue(), intended.GetValue(), options)
+	if err != nil {
+		return nil, fmt.Errorf("Merge: %w", err)
+	}
+	intendedChanges := make(map[string]diff.Change)
+	for _, v := range changes {
+		intendedChanges[v.Path] = v
+	}
+	result := &Result{Kept: make([]diff.Change, 0), Conflicts: make([]Conflict, 0)}
+	for _, edit := range edits {
+		change, changed := intendedChanges[edit.Path]
+		if changed && change.Type == edit.Type && pathmap.EqualValue(change.After, edit.After) {
+			// the edit already made what the intended config wants
+			continue
+		}
+		services := owners(edit.Path)
+		if isLeafListChange(edit) {
+			current, merged, err := leafListDelta(intended, edit)
+			if err != nil {
+				return nil, fmt.Errorf("Merge: %w", err)
+			}
+			// removing an element of an owned leaf-list conflicts if intended still has it
+			removed := elementsNotIn(edit.Before, edit.After)
+			if len(services) != 0 && len(elementsNotIn(removed, current)) != len(removed) {
+				result.Conflicts = append(result.Conflicts, Conflict{
+					Path:     edit.Path,
+					Type:     edit.Type,
+					Base:     edit.Before,
+					Actual:   edit.After,
+					Intended: current,
+					Services: services,
+				})
+				continue
+			}
+			if (current != nil || len(merged) != 0) && !pathmap.EqualValue(current, merged) {
+				result.Kept = append(result.Kept, edit)
+			}
+			continue
+		}
+		if len(services) != 0 || changed {
+			result.Conflicts = append(result.Conflicts, Conflict{
+				Path:     edit.Path,
+				Type:     edit.Type,
+				Base:     edit.Before,
+				Actual:   edit.After,
+				Intended: change.After,
+				Services: services,
+			})
+			continue
+		}
+		result.Kept = append(result.Kept, edit)
+	}
+	if len(result.Conflicts) != 0 {
+		return result, nil
+	}
+	if err := apply(intended, result.Kept); err != nil {
+		return nil, fmt.Errorf("Merge: %w", err)
+	}
+	return result, nil
+}
+
+// apply applies edits to config. The key leaves of a list entry are deleted after its other leaves.
+func apply(config orderedmap.OrderedmapInterfaces, edits []diff.Change) error {
+	deletes := make([][]string, 0)
+	for _, v := range edits {
+		keys, err := yangpath.SplitPath(v.Path)
+		if err != nil {
+			return fmt.Errorf("apply: %w", err)
+		}
+		value := v.After
+		if isLeafListChange(v) {
+			_, merged, err := leafListDelta(config, v)
+			if err != nil {
+				return fmt.Errorf("apply: %w", err)
+			}
+			if len(merged) == 0 {
+				deletes = append(deletes, keys)
+				continue
+			}
+			value = merged
+		} else if v.Type == diff.CHANGE_DELETE {
+			deletes = append(deletes, keys)
+			continue
+		}
+		if err := config.RecursiveSet(keys, value); err != nil {
+			return fmt.Errorf("apply: %w", err)
+		}
+	}
+	sort.SliceStable(deletes, func(i, j int) bool {
+		return !yangpath.IsListKeyLeaf(deletes[i]) && yangpath.IsListKeyLeaf(deletes[j])
+	})
+	for _, keys := range deletes {
+		if err := config.RecursiveDelete(keys); err != nil {
+			return fmt.Errorf("apply: %w", err)
+		}
+	}
+	return nil
+}
+
+// isLeafListChange reports whether change changes a leaf-list.
+func isLeafListChange(change diff.Change) bool {
+	return pathmap.IsLeafList(change.Before) || pathmap.IsLeafList(change.After)
+}
+
+// leafListDelta returns the leaf-list of config at the path of change and the leaf-list with the elements
+// added by change appended and the elements removed by change removed.
+func leafListDelta(config orderedmap.OrderedmapInterfaces, change diff.Change) (interface{}, []interface{}, error) {
+	keys, err := yangpath.SplitPath(change.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("leafListDelta: %w", err)
+	}
+	current, _, err := config.RecursiveGet(keys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("leafListDelta: %w", err)
+	}
+	return current, pathmap.LeafListDelta(current, elementsNotIn(change.Before, change.After), elementsNotIn(change.After, change.Before)), nil
+}
+
+// elementsNotIn returns the elements of the leaf-list x that are not in the leaf-list y.
+func elementsNotIn(x any, y any) []interface{} {
+	result := make([]interface{}, 0)
+	rx := reflect.ValueOf(x)
+	if rx.Kind() != reflect.Slice {
+		return result
+	}
+	ry := reflect.ValueOf(y)
+	for i := 0; i < rx.Len(); i++ {
+		element := rx.Index(i).Interface()
+		found := false
+		for j := 0; ry.Kind() == reflect.Slice && j < ry.Len(); j++ {
+			if pathmap.EqualValue(element, ry.Index(j).Interface()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, element)
+		}
+	}
+	return result
+}
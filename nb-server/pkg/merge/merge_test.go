@@ -0,0 +1,181 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/nttcom/ksot/nb-server/pkg/composite"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	refs := map[string]pathmap.PathMapInterface{
+		"serviceA": pathmap.PathMap{
+			"/A/mtu":      pathmap.NewPathMapValueSafe([]string{"A", "mtu"}, 1500, make(map[string]string)),
+			"/A/vlans":    pathmap.NewPathMapValueSafe([]string{"A", "vlans"}, []int{10}, make(map[string]string)),
+			"/B[name=b0]": pathmap.NewPathMapValueSafe([]string{"B[name=b0]"}, "", make(map[string]string)),
+		},
+	}
+	type test struct {
+		base          string
+		actual        string
+		intended      string
+		want          string
+		wantKept      []diff.Change
+		wantConflicts []Conflict
+	}
+	tests := map[string]test{
+		"正常系: 所有されていないパスの変更を維持": {
+			base:     `{"A":{"mtu":1500,"desc":"a"},"B":[{"name":"b0","v":1}]}`,
+			actual:   `{"A":{"mtu":1500,"desc":"oob"},"B":[{"name":"b0","v":1},{"name":"b1","v":2}],"C":"c"}`,
+			intended: `{"A":{"mtu":9000,"desc":"a"},"B":[{"name":"b0","v":1}]}`,
+			want:     `{"A":{"mtu":9000,"desc":"oob"},"B":[{"name":"b0","v":1},{"name":"b1","v":2}],"C":"c"}`,
+			wantKept: []diff.Change{
+				{Path: "/A/desc", Type: diff.CHANGE_UPDATE, Before: "a", After: "oob"},
+				{Path: "/B[name=b1]/name", Type: diff.CHANGE_CREATE, After: "b1"},
+				{Path: "/B[name=b1]/v", Type: diff.CHANGE_CREATE, After: float64(2)},
+				{Path: "/C", Type: diff.CHANGE_CREATE, After: "c"},
+			},
+			wantConflicts: []Conflict{},
+		},
+		"正常系: 所有されていないパスの削除を維持": {
+			base:          `{"A":{"mtu":1500,"desc":"a"}}`,
+			actual:        `{"A":{"mtu":1500}}`,
+			intended:      `{"A":{"mtu":1500,"desc":"a"}}`,
+			want:          `{"A":{"mtu":1500}}`,
+			wantKept:      []diff.Change{{Path: "/A/desc", Type: diff.CHANGE_DELETE, Before: "a"}},
+			wantConflicts: []Conflict{},
+		},
+		"正常系: 所有されていないエントリの削除を維持": {
+			base:     `{"B":[{"name":"b0","v":1},{"name":"b1","v":2}]}`,
+			actual:   `{"B":[{"name":"b0","v":1}]}`,
+			intended: `{"B":[{"name":"b0","v":1},{"name":"b1","v":2}]}`,
+			want:     `{"B":[{"name":"b0","v":1}]}`,
+			wantKept: []diff.Change{
+				{Path: "/B[name=b1]/name", Type: diff.CHANGE_DELETE, Before: "b1"},
+				{Path: "/B[name=b1]/v", Type: diff.CHANGE_DELETE, Before: float64(2)},
+			},
+			wantConflicts: []Conflict{},
+		},
+		"異常系: 所有されたパスの変更": {
+			base:     `{"A":{"mtu":1500},"B":[{"name":"b0","v":1}]}`,
+			actual:   `{"A":{"mtu":1500},"B":[{"name":"b0","v":5}]}`,
+			intended: `{"A":{"mtu":9000},"B":[{"name":"b0","v":1}]}`,
+			want:     `{"A":{"mtu":9000},"B":[{"name":"b0","v":1}]}`,
+			wantKept: []diff.Change{},
+			wantConflicts: []Conflict{
+				{Path: "/B[name=b0]/v", Type: diff.CHANGE_UPDATE, Base: float64(1), Actual: float64(5), Services: []string{"serviceA"}},
+			},
+		},
+		"異常系: 意図した設定と異なる変更": {
+			base:     `{"D":"d"}`,
+			actual:   `{"D":"oob"}`,
+			intended: `{"D":"new"}`,
+			want:     `{"D":"new"}`,
+			wantKept: []diff.Change{},
+			wantConflicts: []Conflict{
+				{Path: "/D", Type: diff.CHANGE_UPDATE, Base: "d", Actual: "oob", Intended: "new"},
+			},
+		},
+		"正常系: 所有されたリーフリストに手動で追加された要素を維持": {
+			base:     `{"A":{"vlans":[10]}}`,
+			actual:   `{"A":{"vlans":[10,99]}}`,
+			intended: `{"A":{"vlans":[10,20]}}`,
+			want:     `{"A":{"vlans":[10,20,99]}}`,
+			wantKept: []diff.Change{
+				{Path: "/A/vlans", Type: diff.CHANGE_UPDATE, Before: []interface{}{float64(10)}, After: []interface{}{float64(10), float64(99)}},
+			},
+			wantConflicts: []Conflict{},
+		},
+		"正常系: 所有されていないリーフリストからの要素の削除を維持": {
+			base:     `{"E":{"tags":["a","b"]}}`,
+			actual:   `{"E":{"tags":["a"]}}`,
+			intended: `{"E":{"tags":["a","b","c"]}}`,
+			want:     `{"E":{"tags":["a","c"]}}`,
+			wantKept: []diff.Change{
+				{Path: "/E/tags", Type: diff.CHANGE_UPDATE, Before: []interface{}{"a", "b"}, After: []interface{}{"a"}},
+			},
+			wantConflicts: []Conflict{},
+		},
+		"異常系: 所有されたリーフリストから意図した要素の削除": {
+			base:     `{"A":{"vlans":[10,20]}}`,
+			actual:   `{"A":{"vlans":[20]}}`,
+			intended: `{"A":{"vlans":[10,20,30]}}`,
+			want:     `{"A":{"vlans":[10,20,30]}}`,
+			wantKept: []diff.Change{},
+			wantConflicts: []Conflict{
+				{
+					Path:     "/A/vlans",
+					Type:     diff.CHANGE_UPDATE,
+					Base:     []interface{}{float64(10), float64(20)},
+					Actual:   []interface{}{float64(20)},
+					Intended: []interface{}{float64(10), float64(20), float64(30)},
+					Services: []string{"serviceA"},
+				},
+			},
+		},
+		"正常系: 意図した設定と同じ変更": {
+			base:          `{"A":{"mtu":1500}}`,
+			actual:        `{"A":{"mtu":9000}}`,
+			intended:      `{"A":{"mtu":9000}}`,
+			want:          `{"A":{"mtu":9000}}`,
+			wantKept:      []diff.Change{},
+			wantConflicts: []Conflict{},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			base, err := orderedmap.New([]byte(tt.base))
+			assert.Nil(t, err)
+			actual, err := orderedmap.New([]byte(tt.actual))
+			assert.Nil(t, err)
+			intended, err := orderedmap.New([]byte(tt.intended))
+			assert.Nil(t, err)
+			owners, err := pathmap.NewOwners(nil, refs)
+			assert.Nil(t, err)
+			got, err := Merge(base, actual, intended, owners, diff.TreeOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantKept, got.Kept)
+			assert.Equal(t, tt.wantConflicts, got.Conflicts)
+			want, err := orderedmap.New([]byte(tt.want))
+			assert.Nil(t, err)
+			changes, err := diff.DiffTrees(want.GetValue(), intended.GetValue(), diff.TreeOptions{})
+			assert.Nil(t, err)
+			assert.Empty(t, changes)
+		})
+	}
+}
+
+func TestMergeForDeletedOwnedPath(t *testing.T) {
+	t.Parallel()
+	oldRefs := map[string]map[string]pathmap.PathMapInterface{
+		"deviceA": {
+			"serviceA": pathmap.PathMap{
+				"/A/mtu": pathmap.NewPathMapValueSafe([]string{"A", "mtu"}, 1500, make(map[string]string)),
+			},
+		},
+	}
+	newRefs, err := composite.NewCompositeInterface().UpdateDeviceRefForComposite(map[string]map[string]pathmap.PathMapInterface{
+		"serviceA": {"deviceA": pathmap.PathMap{}},
+	}, oldRefs)
+	assert.Nil(t, err)
+	base, err := orderedmap.New([]byte(`{"A":{"mtu":1500,"desc":"a"}}`))
+	assert.Nil(t, err)
+	actual, err := orderedmap.New([]byte(`{"A":{"mtu":9000,"desc":"a"}}`))
+	assert.Nil(t, err)
+	intended, err := orderedmap.New([]byte(`{"A":{"desc":"a"}}`))
+	assert.Nil(t, err)
+	owners, err := pathmap.NewOwners(nil, oldRefs["deviceA"], newRefs["deviceA"])
+	assert.Nil(t, err)
+	got, err := Merge(base, actual, intended, owners, diff.TreeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []diff.Change{}, got.Kept)
+	assert.Equal(t, []Conflict{
+		{Path: "/A/mtu", Type: diff.CHANGE_UPDATE, Base: float64(1500), Actual: float64(9000), Services: []string{"serviceA"}},
+	}, got.Conflicts)
+}
@@ -3,8 +3,19 @@ package model
 type ServiceReqToGitServer struct {
 	Path       string `json:"path"`
 	StringData string `json:"string_data"`
+	// CommitMessage, if set, is used by the github-server instead of Path.
+	CommitMessage string `json:"commit_message,omitempty"`
 }
 
 type ServiceAllResFromGitServer struct {
 	StringData string `json:"string_data"`
 }
+
+type DirEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+}
+
+type DirResFromGitServer struct {
+	Entries []DirEntry `json:"entries"`
+}
@@ -2,10 +2,13 @@ package orderedmap
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
 )
 
 type OrderedmapInterfaces interface {
@@ -17,8 +20,18 @@ type OrderedmapInterfaces interface {
 	MakeByte() ([]byte, error)
 	// return orderedmap
 	GetValue() *orderedmap.OrderedMap
+	// read
+	RecursiveGet(keys []string) (interface{}, bool, error)
+	Exists(keys []string) (bool, error)
+	Walk(listKeys yangpath.ListKeys, fn WalkFunc) error
 }
 
+// WalkFunc is called by Walk with the path of every node. Returning SkipSubtree skips the nodes under a container,
+// a list or a list entry, and any other error stops the walk.
+type WalkFunc func(keys []string, value interface{}) error
+
+var SkipSubtree = errors.New("skip subtree")
+
 type Orderedmap struct {
 	Value *orderedmap.OrderedMap
 }
@@ -33,53 +46,55 @@ func New(b []byte) (*Orderedmap, error) {
 	return &Orderedmap{Value: result}, nil
 }
 
-func returnEndString(s string) string {
-	rarr := []rune(s)
-	if len(rarr) == 0 {
-		return ""
+func convertPathToKey(path string) (string, []yangpath.Key, error) {
+	// expected X or X[xxx=xxx] with any number of key predicates
+	segment, err := yangpath.ParseSegment(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("convertPathToKeys: %w", err)
 	}
-	return string(rarr[len(rarr)-1])
+	return segment.Name, segment.Keys, nil
 }
 
-func convertPathToKey(path string) (string, string, string, error) {
-	// expected X or X[xxx=xxx]
-	mapKey, listKey, listValue := "", "", ""
-	if returnEndString(path) == "]" {
-		equalSplits := strings.Split(path, "=")
-		if len(equalSplits) != 2 || equalSplits[0] == "" || equalSplits[1] == "" {
-			return mapKey, listKey, listValue, fmt.Errorf("convertPathToKeys: noexpected path %v", path)
+// matchEntry reports whether the list entry has every key value.
+func matchEntry(entry orderedmap.OrderedMap, keys []yangpath.Key) bool {
+	for _, key := range keys {
+		v, ok := entry.Get(key.Name)
+		if !ok || keyValue(v) != key.Value {
+			return false
 		}
+	}
+	return true
+}
 
-		rightAboutSplits := strings.Split(equalSplits[1], "]")
-		if len(rightAboutSplits) != 2 || rightAboutSplits[0] == "" || rightAboutSplits[1] != "" {
-			return mapKey, listKey, listValue, fmt.Errorf("convertPathToKeys: noexpected path %v", path)
-		}
-		listValue = rightAboutSplits[0]
-
-		leftAboutSplits := strings.Split(equalSplits[0], "[")
-
-		if len(leftAboutSplits) != 2 || leftAboutSplits[0] == "" || leftAboutSplits[1] == "" {
-			return mapKey, listKey, listValue, fmt.Errorf("convertPathToKeys: noexpected path %v", path)
-		}
-		mapKey, listKey = leftAboutSplits[0], leftAboutSplits[1]
-	} else {
-		mapKey = path
+// keyValue returns the value of a list key as in a key predicate. A number is written without an exponent,
+// as JSON numbers decode as float64.
+func keyValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
 	}
+	return fmt.Sprintf("%v", v)
+}
 
-	return mapKey, listKey, listValue, nil
+// newEntry returns a list entry holding the key values.
+func newEntry(keys []yangpath.Key) *orderedmap.OrderedMap {
+	result := orderedmap.New()
+	for _, key := range keys {
+		result.Set(key.Name, key.Value)
+	}
+	return result
 }
 
 func recursiveSetParentElement(keys []string, omap *orderedmap.OrderedMap, value interface{}) (*orderedmap.OrderedMap, error) {
-	mapKey, listKey, listValue, err := convertPathToKey(keys[0])
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("recursiveSetParentElement: keys is empty")
+	}
+	mapKey, listKeys, err := convertPathToKey(keys[0])
 	if err != nil {
 		return nil, fmt.Errorf("recursiveSetParentElement: %w", err)
 	}
-	if len(keys) == 0 {
-		return nil, fmt.Errorf("recursiveSetParentElement: keys is empty: %v", keys[0])
-	}
 	if len(keys) == 1 {
-		if listKey != "" || listValue != "" {
-			return nil, fmt.Errorf("recursiveSetParentElement: list is not key: %v", keys[0])
+		if len(listKeys) != 0 {
+			return setListEntry(omap, mapKey, listKeys, value)
 		}
 		omap.Set(mapKey, value)
 		return omap, nil
@@ -88,14 +103,14 @@ func recursiveSetParentElement(keys []string, omap *orderedmap.OrderedMap, value
 	v, ok := omap.Get(mapKey)
 	if ok {
 		// list case
-		if listKey != "" && listValue != "" {
+		if len(listKeys) != 0 {
 			vlist, ok := v.([]interface{})
 			if !ok {
 				return nil, fmt.Errorf("recursiveSetParentElement: not list value: %v", v)
 			}
 			for i, v := range vlist {
 				vmap := v.(orderedmap.OrderedMap)
-				if vmap.Values()[listKey] == listValue {
+				if matchEntry(vmap, listKeys) {
 					newVlistV, err := recursiveSetParentElement(keys[1:], &vmap, value)
 					if err != nil {
 						return nil, fmt.Errorf("recursiveSetParentElement: %w", err)
@@ -105,9 +120,7 @@ func recursiveSetParentElement(keys []string, omap *orderedmap.OrderedMap, value
 					return omap, nil
 				}
 			}
-			newVlistV := orderedmap.New()
-			newVlistV.Set(listKey, listValue)
-			newVlistV, err = recursiveSetParentElement(keys[1:], newVlistV, value)
+			newVlistV, err := recursiveSetParentElement(keys[1:], newEntry(listKeys), value)
 			if err != nil {
 				return nil, fmt.Errorf("recursiveSetParentElement: %w", err)
 			}
@@ -124,16 +137,14 @@ func recursiveSetParentElement(keys []string, omap *orderedmap.OrderedMap, value
 		if err != nil {
 			return nil, fmt.Errorf("recursiveSetParentElement: not map value2: %v", v)
 		}
-		omap.Set(keys[0], *nvmap)
+		omap.Set(mapKey, *nvmap)
 		return omap, nil
 	}
 
 	// list case
-	if listKey != "" && listValue != "" {
+	if len(listKeys) != 0 {
 		vlist := make([]interface{}, 0)
-		vlistV := orderedmap.New()
-		vlistV.Set(listKey, listValue)
-		newVlistV, err := recursiveSetParentElement(keys[1:], vlistV, value)
+		newVlistV, err := recursiveSetParentElement(keys[1:], newEntry(listKeys), value)
 		if err != nil {
 			return nil, fmt.Errorf("recursiveSetParentElement: %w", err)
 		}
@@ -147,21 +158,21 @@ func recursiveSetParentElement(keys []string, omap *orderedmap.OrderedMap, value
 	if err != nil {
 		return nil, fmt.Errorf("recursiveSetParentElement: not map value1: %v", v)
 	}
-	omap.Set(keys[0], *nvmap)
+	omap.Set(mapKey, *nvmap)
 	return omap, nil
 }
 
 func recursiveDeleteParentElement(keys []string, omap *orderedmap.OrderedMap) (*orderedmap.OrderedMap, error) {
-	mapKey, listKey, listValue, err := convertPathToKey(keys[0])
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("recursiveDeleteParentElement: keys is empty")
+	}
+	mapKey, listKeys, err := convertPathToKey(keys[0])
 	if err != nil {
 		return nil, fmt.Errorf("recursiveDeleteParentElement: %w", err)
 	}
-	if len(keys) == 0 {
-		return nil, fmt.Errorf("recursiveDeleteParentElement: keys is empty: %v", keys[0])
-	}
 	if len(keys) == 1 {
-		if listKey != "" || listValue != "" {
-			return nil, fmt.Errorf("recursiveDeleteParentElement: list is not key: %v", keys[0])
+		if len(listKeys) != 0 {
+			return deleteListEntry(omap, mapKey, listKeys)
 		}
 		omap.Delete(mapKey)
 		return omap, nil
@@ -169,7 +180,7 @@ func recursiveDeleteParentElement(keys []string, omap *orderedmap.OrderedMap) (*
 	v, ok := omap.Get(mapKey)
 	if ok {
 		// list case
-		if listKey != "" && listValue != "" {
+		if len(listKeys) != 0 {
 			vlist, ok := v.([]interface{})
 			if !ok {
 				return nil, fmt.Errorf("recursiveDeleteParentElement: not list value: %v", v)
@@ -179,7 +190,7 @@ func recursiveDeleteParentElement(keys []string, omap *orderedmap.OrderedMap) (*
 				if !ok {
 					return nil, fmt.Errorf("recursiveDeleteParentElement: not map value: %v", v)
 				}
-				if vmap.Values()[listKey] == listValue {
+				if matchEntry(vmap, listKeys) {
 					newVlistV, err := recursiveDeleteParentElement(keys[1:], &vmap)
 					if err != nil {
 						return nil, fmt.Errorf("recursiveDeleteParentElement: %w", err)
@@ -222,6 +233,60 @@ func recursiveDeleteParentElement(keys []string, omap *orderedmap.OrderedMap) (*
 	return omap, nil
 }
 
+// setListEntry replaces the entry of the list mapKey selected by listKeys by value, or appends value.
+func setListEntry(omap *orderedmap.OrderedMap, mapKey string, listKeys []yangpath.Key, value interface{}) (*orderedmap.OrderedMap, error) {
+	entry, ok := value.(orderedmap.OrderedMap)
+	if !ok {
+		return nil, fmt.Errorf("setListEntry: not map value: %v", value)
+	}
+	for _, key := range listKeys {
+		if _, ok := entry.Get(key.Name); !ok {
+			entry.Set(key.Name, key.Value)
+		}
+	}
+	vlist := make([]interface{}, 0)
+	if v, ok := omap.Get(mapKey); ok {
+		if vlist, ok = v.([]interface{}); !ok {
+			return nil, fmt.Errorf("setListEntry: not list value: %v", v)
+		}
+	}
+	for i, v := range vlist {
+		vmap, ok := v.(orderedmap.OrderedMap)
+		if ok && matchEntry(vmap, listKeys) {
+			vlist[i] = entry
+			omap.Set(mapKey, vlist)
+			return omap, nil
+		}
+	}
+	omap.Set(mapKey, append(vlist, entry))
+	return omap, nil
+}
+
+// deleteListEntry deletes the entry of the list mapKey selected by listKeys, and the list if it becomes empty.
+func deleteListEntry(omap *orderedmap.OrderedMap, mapKey string, listKeys []yangpath.Key) (*orderedmap.OrderedMap, error) {
+	v, ok := omap.Get(mapKey)
+	if !ok {
+		return omap, nil
+	}
+	vlist, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("deleteListEntry: not list value: %v", v)
+	}
+	for i, v := range vlist {
+		vmap, ok := v.(orderedmap.OrderedMap)
+		if ok && matchEntry(vmap, listKeys) {
+			vlist = append(vlist[:i], vlist[i+1:]...)
+			break
+		}
+	}
+	if len(vlist) == 0 {
+		omap.Delete(mapKey)
+	} else {
+		omap.Set(mapKey, vlist)
+	}
+	return omap, nil
+}
+
 func (o *Orderedmap) RecursiveSet(keys []string, value interface{}) error {
 	newValue, err := recursiveSetParentElement(keys, o.Value, value)
 	if err != nil {
@@ -240,6 +305,104 @@ func (o *Orderedmap) RecursiveDelete(keys []string) error {
 	return nil
 }
 
+// RecursiveGet returns the value at keys, which use the same syntax as RecursiveSet. Empty keys return the whole map.
+func (o *Orderedmap) RecursiveGet(keys []string) (interface{}, bool, error) {
+	var current interface{} = *o.Value
+	for _, key := range keys {
+		mapKey, listKeys, err := convertPathToKey(key)
+		if err != nil {
+			return nil, false, fmt.Errorf("RecursiveGet: %w", err)
+		}
+		vmap, ok := current.(orderedmap.OrderedMap)
+		if !ok {
+			return nil, false, nil
+		}
+		if current, ok = vmap.Get(mapKey); !ok {
+			return nil, false, nil
+		}
+		if len(listKeys) == 0 {
+			continue
+		}
+		vlist, ok := current.([]interface{})
+		if !ok {
+			return nil, false, nil
+		}
+		found := false
+		for _, v := range vlist {
+			if entry, ok := v.(orderedmap.OrderedMap); ok && matchEntry(entry, listKeys) {
+				current, found = entry, true
+				break
+			}
+		}
+		if !found {
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
+
+func (o *Orderedmap) Exists(keys []string) (bool, error) {
+	_, ok, err := o.RecursiveGet(keys)
+	if err != nil {
+		return false, fmt.Errorf("Exists: %w", err)
+	}
+	return ok, nil
+}
+
+// Walk calls fn for every container, list, list entry, leaf and leaf-list in depth-first order.
+// A list entry is addressed by its keys as Flatten does.
+func (o *Orderedmap) Walk(listKeys yangpath.ListKeys, fn WalkFunc) error {
+	err := walkElement(make([]string, 0), *o.Value, listKeys, fn)
+	if err != nil && !errors.Is(err, SkipSubtree) {
+		return fmt.Errorf("Walk: %w", err)
+	}
+	return nil
+}
+
+func walkElement(prefix []string, omap orderedmap.OrderedMap, listKeys yangpath.ListKeys, fn WalkFunc) error {
+	for _, k := range omap.Keys() {
+		v, _ := omap.Get(k)
+		keys := append(append(make([]string, 0, len(prefix)+1), prefix...), k)
+		err := fn(keys, v)
+		if errors.Is(err, SkipSubtree) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch vv := v.(type) {
+		case orderedmap.OrderedMap:
+			if err := walkElement(keys, vv, listKeys, fn); err != nil {
+				return err
+			}
+		case []interface{}:
+			if !isListOfMap(vv) {
+				continue
+			}
+			keyNames := listKeys.Get(yangpath.JoinPath(keys))
+			for _, elm := range vv {
+				elmMap := elm.(orderedmap.OrderedMap)
+				segment, err := EntrySegment(k, elmMap, keyNames)
+				if err != nil {
+					return err
+				}
+				entryKeys := append(append(make([]string, 0, len(prefix)+1), prefix...), segment.String())
+				err = fn(entryKeys, elmMap)
+				if errors.Is(err, SkipSubtree) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if err := walkElement(entryKeys, elmMap, listKeys, fn); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (o *Orderedmap) MakeByte() ([]byte, error) {
 	return json.Marshal(o.Value)
 }
@@ -247,3 +410,85 @@ func (o *Orderedmap) MakeByte() ([]byte, error) {
 func (o *Orderedmap) GetValue() *orderedmap.OrderedMap {
 	return o.Value
 }
+
+// Flatten returns every leaf and leaf-list of omap, the value at path, keyed by its pathmap style path.
+// A list entry is addressed by the keys of the list in listKeys, or by its first leaf if the list is not in listKeys.
+func Flatten(path string, omap *orderedmap.OrderedMap, listKeys yangpath.ListKeys) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if err := flattenElement(strings.TrimSuffix(path, "/"), *omap, listKeys, result); err != nil {
+		return nil, fmt.Errorf("Flatten: %w", err)
+	}
+	return result, nil
+}
+
+func flattenElement(prefix string, omap orderedmap.OrderedMap, listKeys yangpath.ListKeys, result map[string]interface{}) error {
+	for _, k := range omap.Keys() {
+		v, _ := omap.Get(k)
+		path := prefix + "/" + k
+		switch vv := v.(type) {
+		case orderedmap.OrderedMap:
+			if err := flattenElement(path, vv, listKeys, result); err != nil {
+				return err
+			}
+		case []interface{}:
+			if !isListOfMap(vv) {
+				result[path] = vv
+				continue
+			}
+			keyNames := listKeys.Get(path)
+			for _, elm := range vv {
+				elmMap := elm.(orderedmap.OrderedMap)
+				segment, err := EntrySegment(k, elmMap, keyNames)
+				if err != nil {
+					return err
+				}
+				if err := flattenElement(prefix+"/"+segment.String(), elmMap, listKeys, result); err != nil {
+					return err
+				}
+			}
+		default:
+			result[path] = vv
+		}
+	}
+	return nil
+}
+
+// EntrySegment returns the segment of an entry of the list name with a key predicate for each of keyNames,
+// or for the first leaf of the entry if keyNames is empty.
+func EntrySegment(name string, entry orderedmap.OrderedMap, keyNames []string) (yangpath.Segment, error) {
+	if len(keyNames) == 0 {
+		for _, k := range entry.Keys() {
+			v, _ := entry.Get(k)
+			switch v.(type) {
+			case orderedmap.OrderedMap, []interface{}:
+				continue
+			}
+			keyNames = []string{k}
+			break
+		}
+		if len(keyNames) == 0 {
+			return yangpath.Segment{}, fmt.Errorf("EntrySegment: no leaf in an entry of %v", name)
+		}
+	}
+	result := yangpath.Segment{Name: name}
+	for _, keyName := range keyNames {
+		value, ok := entry.Get(keyName)
+		if !ok {
+			return yangpath.Segment{}, fmt.Errorf("EntrySegment: no key %v in an entry of %v", keyName, name)
+		}
+		result.Keys = append(result.Keys, yangpath.Key{Name: keyName, Value: keyValue(value)})
+	}
+	return result, nil
+}
+
+func isListOfMap(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, v := range list {
+		if _, ok := v.(orderedmap.OrderedMap); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -2,8 +2,10 @@ package orderedmap
 
 import (
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -229,3 +231,182 @@ func TestRecursiveDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestFlatten(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		path     string
+		arg1     string
+		listKeys yangpath.ListKeys
+		want     map[string]interface{}
+		wantErr  bool
+	}
+	tests := map[string]test{
+		"正常系: container、list、leaf-list": {
+			arg1: `{"A":{"B":{"C":"c"}},"D":{"E":[{"F":"f0","G":{"H":1}},{"F":"f1"}]},"L":["a","b"]}`,
+			want: map[string]interface{}{
+				"/A/B/C":         "c",
+				"/D/E[F=f0]/F":   "f0",
+				"/D/E[F=f0]/G/H": float64(1),
+				"/D/E[F=f1]/F":   "f1",
+				"/L":             []interface{}{"a", "b"},
+			},
+		},
+		"正常系: 複数キーのlist": {
+			arg1:     `{"route":[{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1},{"prefix":"10.0.0.0/8","next-hop":"[::1]","metric":2}]}`,
+			listKeys: yangpath.ListKeys{"/routes/route": {"prefix", "next-hop"}},
+			path:     "/routes",
+			want: map[string]interface{}{
+				"/routes/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/prefix":   "10.0.0.0/8",
+				"/routes/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/next-hop": "1.1.1.1",
+				"/routes/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/metric":   float64(1),
+				`/routes/route[prefix=10.0.0.0/8][next-hop="[::1]"]/prefix`:   "10.0.0.0/8",
+				`/routes/route[prefix=10.0.0.0/8][next-hop="[::1]"]/next-hop`: "[::1]",
+				`/routes/route[prefix=10.0.0.0/8][next-hop="[::1]"]/metric`:   float64(2),
+			},
+		},
+		"異常系: キーのないlist要素": {
+			arg1:     `{"route":[{"prefix":"10.0.0.0/8","metric":1}]}`,
+			listKeys: yangpath.ListKeys{"/route": {"prefix", "next-hop"}},
+			wantErr:  true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			omap, err := New([]byte(tt.arg1))
+			assert.Nil(t, err)
+			got, err := Flatten(tt.path, omap.Value, tt.listKeys)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRecursiveSetAndDeleteListEntry(t *testing.T) {
+	t.Parallel()
+	config, err := New([]byte(`{"A":{"E":[{"F":"f0","G":"g0"},{"F":"f1","G":"g1","H":"h1"}]}}`))
+	assert.Nil(t, err)
+	entry, err := New([]byte(`{"F":"f1","G":"g2"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, config.RecursiveSet([]string{"A", "E[F=f1]"}, *entry.Value))
+	newEntry, err := New([]byte(`{"G":"g3"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, config.RecursiveSet([]string{"A", "E[F=f2]"}, *newEntry.Value))
+	assert.Nil(t, config.RecursiveDelete([]string{"A", "E[F=f0]"}))
+	got, err := config.MakeByte()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"A":{"E":[{"F":"f1","G":"g2"},{"G":"g3","F":"f2"}]}}`, string(got))
+	assert.NotNil(t, config.RecursiveSet([]string{"A", "E[F=f3]"}, "e"))
+}
+
+func TestRecursiveSetAndDeleteForMultiKeyList(t *testing.T) {
+	t.Parallel()
+	config, err := New([]byte(`{"route":[{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1}]}`))
+	assert.Nil(t, err)
+	assert.Nil(t, config.RecursiveSet([]string{"route[prefix=10.0.0.0/8][next-hop=1.1.1.1]", "metric"}, 2))
+	assert.Nil(t, config.RecursiveSet([]string{"route[prefix=10.0.0.0/8][next-hop=\"2.2.2.2\"]", "metric"}, 3))
+	assert.Nil(t, config.RecursiveDelete([]string{"route[prefix=10.0.0.0/8][next-hop=1.1.1.1]", "metric"}))
+	got, err := config.MakeByte()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"route":[{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1"},{"prefix":"10.0.0.0/8","next-hop":"2.2.2.2","metric":3}]}`, string(got))
+	assert.NotNil(t, config.RecursiveSet([]string{"route[prefix=10.0.0.0/8", "metric"}, 1))
+}
+
+func TestRecursiveGet(t *testing.T) {
+	t.Parallel()
+	config, err := New([]byte(`{"A":{"B":"b","E":[{"F":"f0","G":"g0"},{"F":"f1","G":"g1"}],"L":["l0","l1"]}}`))
+	assert.Nil(t, err)
+	type test struct {
+		keys      []string
+		want      interface{}
+		wantFound bool
+		wantErr   bool
+	}
+	tests := map[string]test{
+		"正常系: leaf":       {keys: []string{"A", "B"}, want: "b", wantFound: true},
+		"正常系: リスト要素のleaf": {keys: []string{"A", "E[F=f1]", "G"}, want: "g1", wantFound: true},
+		"正常系: leaf-list":  {keys: []string{"A", "L"}, want: []interface{}{"l0", "l1"}, wantFound: true},
+		"正常系: 存在しないリスト要素": {keys: []string{"A", "E[F=f2]", "G"}},
+		"正常系: 存在しないleaf":  {keys: []string{"A", "C"}},
+		"正常系: leafの下":     {keys: []string{"A", "B", "C"}},
+		"異常系: 不正なセグメント":   {keys: []string{"A", "E[F=f0"}, wantErr: true},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, found, err := config.RecursiveGet(tt.keys)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.want, got)
+			exists, err := config.Exists(tt.keys)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantFound, exists)
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	t.Parallel()
+	config, err := New([]byte(`{"A":{"B":"b","E":[{"F":"f0","G":"g0"}]},"C":{"D":"d"}}`))
+	assert.Nil(t, err)
+	paths := make([]string, 0)
+	err = config.Walk(nil, func(keys []string, value interface{}) error {
+		paths = append(paths, strings.Join(keys, "/"))
+		if len(keys) == 1 && keys[0] == "C" {
+			return SkipSubtree
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"A", "A/B", "A/E", "A/E[F=f0]", "A/E[F=f0]/F", "A/E[F=f0]/G", "C"}, paths)
+}
+
+func TestWalkForMultiKeyList(t *testing.T) {
+	t.Parallel()
+	config, err := New([]byte(`{"route":[{"metric":1,"prefix":"10.0.0.0/8","next-hop":"1.1.1.1"}]}`))
+	assert.Nil(t, err)
+	paths := make([]string, 0)
+	err = config.Walk(yangpath.ListKeys{"/route": {"prefix", "next-hop"}}, func(keys []string, value interface{}) error {
+		paths = append(paths, yangpath.JoinPath(keys))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"/route",
+		"/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]",
+		"/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/metric",
+		"/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/prefix",
+		"/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/next-hop",
+	}, paths)
+}
+
+func TestNumericListKey(t *testing.T) {
+	t.Parallel()
+	config, err := New([]byte(`{"acl":{"entry":[{"seq":1000000,"action":"permit"}]}}`))
+	assert.Nil(t, err)
+	got, found, err := config.RecursiveGet([]string{"acl", "entry[seq=1000000]", "action"})
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "permit", got)
+	leaves, err := Flatten("", config.Value, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"/acl/entry[seq=1000000]/seq":    float64(1000000),
+		"/acl/entry[seq=1000000]/action": "permit",
+	}, leaves)
+	assert.Nil(t, config.RecursiveSet([]string{"acl", "entry[seq=1000000]", "action"}, "deny"))
+	b, err := config.MakeByte()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"acl":{"entry":[{"seq":1000000,"action":"deny"}]}}`, string(b))
+}
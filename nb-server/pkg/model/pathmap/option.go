@@ -0,0 +1,131 @@
+package pathmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// OPTIONS_KEY is the reserved key under which the options of a pathmap are stored in output.json and ref.json.
+const OPTIONS_KEY = "@options"
+
+const (
+	OPTION_OPERATION  = "operation"
+	OPTION_ORDERED_BY = "ordered-by"
+	OPTION_OWNER      = "owner"
+)
+
+const (
+	// the leaves of a container or list value are merged into the device config
+	OPERATION_MERGE = "merge"
+	// the value replaces the whole subtree on the device
+	OPERATION_REPLACE = "replace"
+	// the path is deleted from the device, the value is ignored
+	OPERATION_DELETE = "delete"
+)
+
+const (
+	ORDERED_BY_USER   = "user"
+	ORDERED_BY_SYSTEM = "system"
+)
+
+const (
+	OWNER_SHARED = "shared"
+	// no other service may set the path or a path under it
+	OWNER_EXCLUSIVE = "exclusive"
+)
+
+var optionValues = map[string][]string{
+	OPTION_OPERATION:       {OPERATION_MERGE, OPERATION_REPLACE, OPERATION_DELETE},
+	OPTION_ORDERED_BY:      {ORDERED_BY_USER, ORDERED_BY_SYSTEM},
+	OPTION_OWNER:           {OWNER_SHARED, OWNER_EXCLUSIVE},
+	OPTION_CONFLICT_POLICY: {CONFLICT_POLICY_ERROR, CONFLICT_POLICY_PRIORITY, CONFLICT_POLICY_LAST_WRITER_WINS},
+}
+
+// copyOption validates the recognised options and returns a copy of opt.
+func copyOption(opt map[string]string) (map[string]string, error) {
+	result := make(map[string]string)
+	for k, v := range opt {
+		if values, ok := optionValues[k]; ok && !contains(values, v) {
+			return nil, fmt.Errorf("noexpected option %v=%v", k, v)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAtomic reports whether a value with opt is applied as a whole instead of leaf by leaf.
+func IsAtomic(opt map[string]string) bool {
+	return Operation(opt) == OPERATION_REPLACE || Operation(opt) == OPERATION_DELETE
+}
+
+// Operation returns the operation of opt, which defaults to merge.
+func Operation(opt map[string]string) string {
+	if v, ok := opt[OPTION_OPERATION]; ok {
+		return v
+	}
+	return OPERATION_MERGE
+}
+
+// IsExclusive reports whether no other service may set the path of a value with opt or a path under it.
+func IsExclusive(opt map[string]string) bool {
+	return opt[OPTION_OWNER] == OWNER_EXCLUSIVE || IsAtomic(opt)
+}
+
+// IsOrderedByUser reports whether the order of a leaf-list with opt is significant.
+func IsOrderedByUser(opt map[string]string) bool {
+	return opt[OPTION_ORDERED_BY] == ORDERED_BY_USER
+}
+
+// sortLeafList returns a sorted copy of a leaf-list ordered by the system.
+func sortLeafList(value any) any {
+	switch v := value.(type) {
+	case []string:
+		result := append(make([]string, 0, len(v)), v...)
+		sort.Strings(result)
+		return result
+	case []int:
+		result := append(make([]int, 0, len(v)), v...)
+		sort.Ints(result)
+		return result
+	case []float64:
+		result := append(make([]float64, 0, len(v)), v...)
+		sort.Float64s(result)
+		return result
+	case []uint:
+		result := append(make([]uint, 0, len(v)), v...)
+		sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+		return result
+	case []int64:
+		result := append(make([]int64, 0, len(v)), v...)
+		sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+		return result
+	case []uint64:
+		result := append(make([]uint64, 0, len(v)), v...)
+		sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+		return result
+	case []json.Number:
+		result := append(make([]json.Number, 0, len(v)), v...)
+		sort.SliceStable(result, func(i, j int) bool {
+			ni, oki := number(result[i])
+			nj, okj := number(result[j])
+			return oki && okj && ni.Cmp(nj) < 0
+		})
+		return result
+	case []bool:
+		result := append(make([]bool, 0, len(v)), v...)
+		sort.Slice(result, func(i, j int) bool { return !result[i] && result[j] })
+		return result
+	default:
+		return value
+	}
+}
@@ -1,9 +1,13 @@
 package pathmap
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"testing"
 
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -248,6 +252,18 @@ var (
 					option: make(map[string]string),
 				},
 			},
+			Previous: PathMap{
+				"/G/H/I": &PathMapValue{
+					value:  []int{1, 2, 3},
+					path:   []string{"G", "H", "I"},
+					option: make(map[string]string),
+				},
+				"/J/K/L": &PathMapValue{
+					value:  []string{"a", "b", "c"},
+					path:   []string{"J", "K", "L"},
+					option: make(map[string]string),
+				},
+			},
 		},
 	}
 	wantErrs = []error{
@@ -359,3 +375,396 @@ func TestNewathMap(t *testing.T) {
 		})
 	}
 }
+
+func TestCompositePathMapForContainer(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		arg1    string
+		arg2    string
+		want    map[string]interface{}
+		wantErr bool
+	}
+	tests := map[string]test{
+		"正常系: 同じコンテナを深くマージ": {
+			arg1: `{"B":"b","C":{"D":"d"}}`,
+			arg2: `{"C":{"E":"e"},"F":[{"G":"g0","H":"h0"}]}`,
+			want: map[string]interface{}{
+				"/A/B":         "b",
+				"/A/C/D":       "d",
+				"/A/C/E":       "e",
+				"/A/F[G=g0]/G": "g0",
+				"/A/F[G=g0]/H": "h0",
+			},
+		},
+		"異常系: コンテナ内のleafがconflict": {
+			arg1:    `{"C":{"D":"d0"}}`,
+			arg2:    `{"C":{"D":"d1"}}`,
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			x, y := iomap.New(), iomap.New()
+			assert.Nil(t, json.Unmarshal([]byte(tt.arg1), x))
+			assert.Nil(t, json.Unmarshal([]byte(tt.arg2), y))
+			pm, _ := NewPathMap(make(map[string]interface{}))
+			err := pm.Composite([]PathMapInterface{
+				PathMap{"/A": NewPathMapValueSafe([]string{"A"}, *x, make(map[string]string))},
+				PathMap{"/A": NewPathMapValueSafe([]string{"A"}, *y, make(map[string]string))},
+			})
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, pm.GetMapInterface())
+		})
+	}
+}
+
+func TestDiffPathMapForContainer(t *testing.T) {
+	t.Parallel()
+	oldValue, err := NewPathMap(map[string]interface{}{
+		"/A": map[string]interface{}{"B": "b0", "C": "c"},
+	})
+	assert.Nil(t, err)
+	newValue, err := NewPathMap(map[string]interface{}{
+		"/A": map[string]interface{}{"B": "b1", "D": []interface{}{"d0", "d1"}},
+	})
+	assert.Nil(t, err)
+	diffResult, err := oldValue.Diff(newValue)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"/A/D": []string{"d0", "d1"}}, diffResult.Create.GetMapInterface())
+	assert.Equal(t, map[string]interface{}{"/A/B": "b1"}, diffResult.Update.GetMapInterface())
+	assert.Equal(t, map[string]interface{}{"/A/C": "c"}, diffResult.Delete.GetMapInterface())
+}
+
+func TestExpandLeaves(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		arg1    map[string]string
+		want    map[string]interface{}
+		wantErr bool
+	}
+	tests := map[string]test{
+		"正常系: パスの述語から複数キーを取得": {
+			arg1: map[string]string{
+				"/routes/route": `[{"prefix":"10.0.0.0/8","next-hop":"1.1.1.1","metric":1},{"prefix":"10.0.0.0/8","next-hop":"2.2.2.2","metric":2}]`,
+				"/routes/route[prefix=10.0.0.0/8][next-hop=3.3.3.3]/metric": `3`,
+			},
+			want: map[string]interface{}{
+				"/routes/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/prefix":   "10.0.0.0/8",
+				"/routes/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/next-hop": "1.1.1.1",
+				"/routes/route[prefix=10.0.0.0/8][next-hop=1.1.1.1]/metric":   float64(1),
+				"/routes/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/prefix":   "10.0.0.0/8",
+				"/routes/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/next-hop": "2.2.2.2",
+				"/routes/route[prefix=10.0.0.0/8][next-hop=2.2.2.2]/metric":   float64(2),
+				"/routes/route[prefix=10.0.0.0/8][next-hop=3.3.3.3]/metric":   float64(3),
+			},
+		},
+		"正常系: コンテナの後のleafをキーに使用": {
+			arg1: map[string]string{
+				"/A/E": `[{"config":{"mtu":1500},"name":"e0"}]`,
+			},
+			want: map[string]interface{}{
+				"/A/E[name=e0]/config/mtu": float64(1500),
+				"/A/E[name=e0]/name":       "e0",
+			},
+		},
+		"異常系: leafのないリスト要素": {
+			arg1: map[string]string{
+				"/A/E": `[{"config":{"mtu":1500}}]`,
+			},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			pm, _ := NewPathMap(make(map[string]interface{}))
+			for path, v := range tt.arg1 {
+				var value interface{}
+				assert.Nil(t, json.Unmarshal([]byte(v), &value))
+				assert.Nil(t, pm.SetValue(path, value, make(map[string]string)))
+			}
+			got, err := ExpandLeaves(pm)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got.GetMapInterface())
+		})
+	}
+}
+
+func TestNewOwners(t *testing.T) {
+	t.Parallel()
+	var entries interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`[{"name":"eth0","mtu":1500}]`), &entries))
+	serviceA, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, serviceA.SetValue("/interfaces/interface", entries, make(map[string]string)))
+	serviceB, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, serviceB.SetValue("/system/hostname", "a", make(map[string]string)))
+	owners, err := NewOwners(yangpath.ListKeys{"/interfaces/interface": {"name"}}, map[string]PathMapInterface{"serviceA": serviceA, "serviceB": serviceB})
+	assert.Nil(t, err)
+	type test struct {
+		path string
+		want []string
+	}
+	tests := map[string]test{
+		"正常系: リストの値はその要素のリーフを所有": {
+			path: "/interfaces/interface[name=eth0]/mtu",
+			want: []string{"serviceA"},
+		},
+		"正常系: リストの値のパス": {
+			path: "/interfaces/interface",
+			want: []string{"serviceA"},
+		},
+		"正常系: 祖先のパスの所有者": {
+			path: "/system/hostname/x",
+			want: []string{"serviceB"},
+		},
+		"正常系: 所有されていないリスト要素": {
+			path: "/interfaces/interface[name=eth1]/mtu",
+			want: nil,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, owners(tt.path))
+		})
+	}
+}
+
+func TestPathMapOptions(t *testing.T) {
+	t.Parallel()
+	pm, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, pm.SetValue("/A", map[string]interface{}{"B": "b"}, map[string]string{OPTION_OPERATION: OPERATION_REPLACE}))
+	assert.Nil(t, pm.SetValue("/C", []string{"c1", "c0"}, map[string]string{OPTION_ORDERED_BY: ORDERED_BY_SYSTEM}))
+	assert.NotNil(t, pm.SetValue("/D", "d", map[string]string{OPTION_OPERATION: "none"}))
+
+	value, _ := pm.GetValue("/C")
+	assert.Equal(t, []string{"c0", "c1"}, value)
+	leaves, err := ExpandLeaves(pm)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"/A", "/C"}, leaves.GetKeys())
+
+	b, err := json.Marshal(pm.GetStoreMap())
+	assert.Nil(t, err)
+	stored := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal(b, &stored))
+	restored, err := NewPathMap(stored)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"/A", "/C"}, restored.GetKeys())
+	option, _ := restored.GetOption("/A")
+	assert.Equal(t, map[string]string{OPTION_OPERATION: OPERATION_REPLACE}, option)
+
+	// a change of the options only is an update
+	changed, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, changed.SetValue("/A", map[string]interface{}{"B": "b"}, map[string]string{OPTION_OPERATION: OPERATION_DELETE}))
+	assert.Nil(t, changed.SetValue("/C", []string{"c0", "c1"}, map[string]string{OPTION_ORDERED_BY: ORDERED_BY_SYSTEM}))
+	diffResult, err := restored.Diff(changed)
+	assert.Nil(t, err)
+	assert.Empty(t, diffResult.Create.GetKeys())
+	assert.Equal(t, []string{"/A"}, diffResult.Update.GetKeys())
+	assert.Empty(t, diffResult.Delete.GetKeys())
+}
+
+func TestSetValueForSlashInKey(t *testing.T) {
+	t.Parallel()
+	pm, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, pm.SetValue("/interfaces/interface[name=GigabitEthernet0/0/1]/mtu", 1500, make(map[string]string)))
+	path, ok := pm.GetPath("/interfaces/interface[name=GigabitEthernet0/0/1]/mtu")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"interfaces", "interface[name=GigabitEthernet0/0/1]", "mtu"}, path)
+	assert.NotNil(t, pm.SetValue("/A//B", "b", make(map[string]string)))
+	assert.NotNil(t, pm.SetValue("/A/B[name=x", "b", make(map[string]string)))
+
+	entry := iomap.New()
+	assert.Nil(t, json.Unmarshal([]byte(`{"name":"GigabitEthernet0/0/2","mtu":9000}`), entry))
+	assert.Nil(t, pm.SetValue("/interfaces/interface", []interface{}{*entry}, make(map[string]string)))
+	leaves, err := ExpandLeaves(PathMap{"/interfaces/interface": pm["/interfaces/interface"]})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{
+		"/interfaces/interface[name=GigabitEthernet0/0/2]/name",
+		"/interfaces/interface[name=GigabitEthernet0/0/2]/mtu",
+	}, leaves.GetKeys())
+}
+
+func TestEqualValue(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		x    any
+		y    any
+		want bool
+	}
+	tests := map[string]test{
+		"正常系: intとjson.Number":   {x: 1500, y: json.Number("1500"), want: true},
+		"正常系: uint64の最大値":        {x: uint64(18446744073709551615), y: json.Number("18446744073709551615"), want: true},
+		"正常系: float64とdecimal64": {x: 0.1, y: json.Number("0.10"), want: true},
+		"正常系: int64の精度":          {x: int64(9007199254740993), y: json.Number("9007199254740992"), want: false},
+		"正常系: 数値のleaf-list":      {x: []int{1, 2}, y: []json.Number{"1", "2.0"}, want: true},
+		"正常系: 数値と文字列":            {x: 1, y: "1", want: false},
+		"正常系: キー順の異なるコンテナ":       {x: mustContainer(t, `{"a":1,"b":"x"}`), y: mustContainer(t, `{"b":"x","a":1.0}`), want: true},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, EqualValue(tt.x, tt.y))
+		})
+	}
+}
+
+func TestDiffPathMapForReloadedNumbers(t *testing.T) {
+	t.Parallel()
+	newValue, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, newValue.SetValue("/mtu", 1500, make(map[string]string)))
+	assert.Nil(t, newValue.SetValue("/vlans", []uint{10, 20}, make(map[string]string)))
+	assert.Nil(t, newValue.SetValue("/asn", uint64(4294967296), make(map[string]string)))
+	b, err := json.Marshal(newValue.GetStoreMap())
+	assert.Nil(t, err)
+	stored := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	assert.Nil(t, dec.Decode(&stored))
+	oldValue, err := NewPathMap(stored)
+	assert.Nil(t, err)
+
+	diffResult, err := oldValue.Diff(newValue)
+	assert.Nil(t, err)
+	assert.Empty(t, diffResult.Create.GetKeys())
+	assert.Empty(t, diffResult.Update.GetKeys())
+	assert.Empty(t, diffResult.Delete.GetKeys())
+
+	pm, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, pm.Composite([]PathMapInterface{oldValue, newValue}))
+	value, _ := pm.GetValue("/vlans")
+	assert.True(t, EqualValue([]uint{10, 20}, value))
+}
+
+func mustContainer(t *testing.T, s string) iomap.OrderedMap {
+	result := iomap.New()
+	assert.Nil(t, json.Unmarshal([]byte(s), result))
+	return *result
+}
+
+func TestDiffPathMapForProvenance(t *testing.T) {
+	t.Parallel()
+	owner := &Provenance{Services: []string{"serviceA"}}
+	oldValue, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, oldValue.SetValue("/A", map[string]interface{}{"B": "b0", "C": "c"}, make(map[string]string)))
+	assert.Nil(t, oldValue.SetProvenance("/A", owner))
+	newValue, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, newValue.SetValue("/A/B", "b1", make(map[string]string)))
+	assert.Nil(t, newValue.SetProvenance("/A/B", owner))
+	assert.NotNil(t, newValue.SetProvenance("/X", owner))
+
+	diffResult, err := oldValue.Diff(newValue)
+	assert.Nil(t, err)
+	provenance, ok := diffResult.Update.GetProvenance("/A/B")
+	assert.True(t, ok)
+	assert.Equal(t, owner, provenance)
+	provenance, ok = diffResult.Delete.GetProvenance("/A/C")
+	assert.True(t, ok)
+	assert.Equal(t, owner, provenance)
+}
+
+func TestLeafListDelta(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		current  any
+		previous any
+		next     any
+		want     []interface{}
+	}
+	tests := map[string]test{
+		"正常系: 管理外の要素を残して追加": {
+			current:  []interface{}{"manual", "a"},
+			previous: []string{"a"},
+			next:     []string{"a", "b"},
+			want:     []interface{}{"manual", "a", "b"},
+		},
+		"正常系: 以前の寄与だけを削除": {
+			current:  []interface{}{"a", "manual", "b"},
+			previous: []string{"a", "b"},
+			next:     []string{"b"},
+			want:     []interface{}{"manual", "b"},
+		},
+		"正常系: 以前の値がない場合は追加のみ": {
+			current: []interface{}{float64(10)},
+			next:    []int{10, 20},
+			want:    []interface{}{float64(10), 20},
+		},
+		"正常系: 現在の値がない場合": {
+			previous: []string{"a"},
+			next:     []string{"b"},
+			want:     []interface{}{"b"},
+		},
+		"正常系: 全体の削除": {
+			current:  []interface{}{"a", "manual"},
+			previous: []string{"a"},
+			want:     []interface{}{"manual"},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, LeafListDelta(tt.current, tt.previous, tt.next))
+		})
+	}
+}
+
+func TestDiffPathMapForReorderedLeafList(t *testing.T) {
+	t.Parallel()
+	oldValue, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, oldValue.SetValue("/A", []string{"a", "b"}, make(map[string]string)))
+	assert.Nil(t, oldValue.SetValue("/B", []string{"a", "b"}, map[string]string{OPTION_ORDERED_BY: ORDERED_BY_USER}))
+	newValue, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, newValue.SetValue("/A", []string{"b", "a"}, make(map[string]string)))
+	assert.Nil(t, newValue.SetValue("/B", []string{"b", "a"}, map[string]string{OPTION_ORDERED_BY: ORDERED_BY_USER}))
+	diffResult, err := oldValue.Diff(newValue)
+	assert.Nil(t, err)
+	assert.Empty(t, diffResult.Create.GetKeys())
+	assert.Equal(t, []string{"/B"}, diffResult.Update.GetKeys())
+	assert.Empty(t, diffResult.Delete.GetKeys())
+}
+
+func TestOrderLeafList(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		list  []interface{}
+		order any
+		want  []interface{}
+	}
+	tests := map[string]test{
+		"正常系: 管理外の要素の位置を残して並べ替え": {
+			list:  []interface{}{"a", "manual", "b", "c"},
+			order: []string{"c", "a", "b"},
+			want:  []interface{}{"c", "manual", "a", "b"},
+		},
+		"正常系: 順序にない要素": {
+			list:  []interface{}{"a", "b"},
+			order: []string{"b", "x"},
+			want:  []interface{}{"a", "b"},
+		},
+		"正常系: 順序がない場合": {
+			list: []interface{}{"b", "a"},
+			want: []interface{}{"b", "a"},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, OrderLeafList(tt.list, tt.order))
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package pathmap
 
 import (
+	"encoding/json"
 	"fmt"
-	"path/filepath"
-	"reflect"
-	"strings"
+	"sort"
 
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/orderedmap"
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
 	"golang.org/x/exp/maps"
 )
 
@@ -14,7 +16,17 @@ type PathMapInterface interface {
 	GetKeys() []string
 	GetValue(path string) (any, bool)
 	GetMapInterface() map[string]interface{}
+	// GetStoreMap returns GetMapInterface with the options stored under OPTIONS_KEY.
+	GetStoreMap() map[string]interface{}
+	GetOption(path string) (map[string]string, bool)
+	// GetProvenance returns the services owning the value of a composed pathmap.
+	GetProvenance(path string) (*Provenance, bool)
+	SetProvenance(path string, provenance *Provenance) error
 	DeleteValue(path string) bool
+	// Query returns the values at or under the paths matching a pattern with * wildcards.
+	Query(pattern string) (PathMap, error)
+	// DeleteSubtree deletes the values Query returns.
+	DeleteSubtree(pattern string) (int, error)
 	Diff(other PathMapInterface) (*DiffResult, error)
 	Composite([]PathMapInterface) error
 }
@@ -23,10 +35,22 @@ type PathMap map[string]*PathMapValue
 
 var _ PathMapInterface = (PathMap)(nil)
 
+// NewPathMap builds a pathmap from path to value. The options stored by GetStoreMap are restored.
 func NewPathMap(jmap map[string]interface{}) (PathMap, error) {
 	newPathMap := make(PathMap)
+	options, err := decodeOptions(jmap[OPTIONS_KEY])
+	if err != nil {
+		return newPathMap, fmt.Errorf("NewPathMap: %w", err)
+	}
 	for k, v := range jmap {
-		err := newPathMap.SetValue(k, v, make(map[string]string))
+		if k == OPTIONS_KEY {
+			continue
+		}
+		opt, ok := options[k]
+		if !ok {
+			opt = make(map[string]string)
+		}
+		err := newPathMap.SetValue(k, v, opt)
 		if err != nil {
 			return newPathMap, fmt.Errorf("NewPathMap: %w", err)
 		}
@@ -34,13 +58,50 @@ func NewPathMap(jmap map[string]interface{}) (PathMap, error) {
 	return newPathMap, nil
 }
 
+func decodeOptions(v any) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string)
+	if v == nil {
+		return result, nil
+	}
+	pathToOption, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("noexpected %v %v", OPTIONS_KEY, v)
+	}
+	for path, opt := range pathToOption {
+		optMap, ok := opt.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("noexpected %v of %v: %v", OPTIONS_KEY, path, opt)
+		}
+		result[path] = make(map[string]string)
+		for k, v := range optMap {
+			result[path][k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return result, nil
+}
+
+// SplitPath splits path into its segments with the grammar of yangpath.SplitPath.
+func SplitPath(path string) ([]string, error) {
+	return yangpath.SplitPath(path)
+}
+
 func (pm PathMap) SetValue(path string, value any, opt map[string]string) error {
-	pathList := strings.Split(filepath.Clean(path), "/")[1:]
+	pathList, err := SplitPath(path)
+	if err != nil {
+		return fmt.Errorf("SetValue: %w", err)
+	}
+	opt, err = copyOption(opt)
+	if err != nil {
+		return fmt.Errorf("SetValue: %w", err)
+	}
+	if opt[OPTION_ORDERED_BY] == ORDERED_BY_SYSTEM {
+		value = sortLeafList(value)
+	}
 	pathValue, err := NewPathMapValue(pathList, value, opt)
 	if err != nil {
 		return fmt.Errorf("SetValue: %w", err)
 	}
-	pm[filepath.Clean(path)] = pathValue
+	pm[path] = pathValue
 	return nil
 }
 
@@ -49,7 +110,7 @@ func (pm PathMap) GetKeys() []string {
 }
 
 func (pm PathMap) GetValue(path string) (any, bool) {
-	v, ok := pm[filepath.Clean(path)]
+	v, ok := pm[path]
 	if ok {
 		return v.value, ok
 	}
@@ -64,64 +125,145 @@ func (pm PathMap) GetMapInterface() map[string]interface{} {
 	return result
 }
 
+func (pm PathMap) GetProvenance(path string) (*Provenance, bool) {
+	v, ok := pm[path]
+	if !ok || v.provenance == nil {
+		return nil, false
+	}
+	return v.provenance, true
+}
+
+func (pm PathMap) SetProvenance(path string, provenance *Provenance) error {
+	v, ok := pm[path]
+	if !ok {
+		return fmt.Errorf("SetProvenance: not found path %v", path)
+	}
+	v.provenance = provenance
+	return nil
+}
+
+func (pm PathMap) GetStoreMap() map[string]interface{} {
+	result := pm.GetMapInterface()
+	options := make(map[string]map[string]string)
+	for path, pathMapValue := range pm {
+		if len(pathMapValue.option) != 0 {
+			options[path] = pathMapValue.option
+		}
+	}
+	if len(options) != 0 {
+		result[OPTIONS_KEY] = options
+	}
+	return result
+}
+
 func (pm PathMap) GetPath(path string) ([]string, bool) {
-	v, ok := pm[filepath.Clean(path)]
-	return v.path, ok
+	v, ok := pm[path]
+	if ok {
+		return v.path, ok
+	}
+	return nil, ok
 }
 
 func (pm PathMap) GetOption(path string) (map[string]string, bool) {
-	v, ok := pm[filepath.Clean(path)]
-	return v.option, ok
+	v, ok := pm[path]
+	if ok {
+		return v.option, ok
+	}
+	return nil, ok
 }
 
 func (pathMap PathMap) DeleteValue(path string) bool {
-	if _, ok := pathMap[filepath.Clean(path)]; ok {
-		delete(pathMap, filepath.Clean(path))
+	if _, ok := pathMap[path]; ok {
+		delete(pathMap, path)
 		return true
 	}
 	return false
 }
 
+// Diff compares pm with other leaf by leaf, container and list values are expanded into their leaves first.
 func (pm PathMap) Diff(other PathMapInterface) (*DiffResult, error) {
+	listKeys, err := LearnListKeys(nil, pm, other)
+	if err != nil {
+		return nil, fmt.Errorf("DiffPathMap: %w", err)
+	}
+	pm, err = ExpandLeavesWithKeys(pm, listKeys)
+	if err != nil {
+		return nil, fmt.Errorf("DiffPathMap: %w", err)
+	}
+	other, err = ExpandLeavesWithKeys(other, listKeys)
+	if err != nil {
+		return nil, fmt.Errorf("DiffPathMap: %w", err)
+	}
 	result := NewDiffResult()
 	stackKeys := make(map[string]bool)
 	for _, path := range other.GetKeys() {
 		newValue, _ := other.GetValue(path)
+		newOption, _ := other.GetOption(path)
 		if oldValue, ok := pm.GetValue(path); ok {
-			if reflect.DeepEqual(newValue, oldValue) {
+			oldOption, _ := pm.GetOption(path)
+			if (EqualValue(newValue, oldValue) || isReorder(newValue, oldValue, newOption)) && maps.Equal(newOption, oldOption) {
 				stackKeys[path] = true
 				continue
 			}
-			err := result.Update.SetValue(path, newValue, make(map[string]string))
+			err := result.Update.SetValue(path, newValue, newOption)
 			if err != nil {
 				return nil, fmt.Errorf("DiffPathMap: %w", err)
 			}
+			copyProvenance(result.Update, other, path)
+			if err := result.Previous.SetValue(path, oldValue, oldOption); err != nil {
+				return nil, fmt.Errorf("DiffPathMap: %w", err)
+			}
+			copyProvenance(result.Previous, pm, path)
 			stackKeys[path] = true
 			continue
 		}
-		err := result.Create.SetValue(path, newValue, make(map[string]string))
+		err := result.Create.SetValue(path, newValue, newOption)
 		if err != nil {
 			return nil, fmt.Errorf("DiffPathMap: %w", err)
 		}
+		copyProvenance(result.Create, other, path)
 		stackKeys[path] = true
 		continue
 	}
 	for _, path := range pm.GetKeys() {
 		oldValue, _ := pm.GetValue(path)
+		oldOption, _ := pm.GetOption(path)
 		if _, ok := stackKeys[path]; ok {
 			continue
 		}
-		err := result.Delete.SetValue(path, oldValue, make(map[string]string))
+		err := result.Delete.SetValue(path, oldValue, oldOption)
 		if err != nil {
 			return nil, fmt.Errorf("DiffPathMap: %w", err)
 		}
+		copyProvenance(result.Delete, pm, path)
 	}
 	return result, nil
 }
 
+func copyProvenance(dst PathMap, src PathMapInterface, path string) {
+	if provenance, ok := src.GetProvenance(path); ok {
+		dst[path].provenance = provenance
+	}
+}
+
+// Composite merges pmList into pm. Container and list values are merged deeply, leaf by leaf.
 func (pm PathMap) Composite(pmList []PathMapInterface) error {
+	listKeys, err := LearnListKeys(nil, append([]PathMapInterface{pm}, pmList...)...)
+	if err != nil {
+		return fmt.Errorf("CompositePathMap: %w", err)
+	}
+	leaves, err := ExpandLeavesWithKeys(pm, listKeys)
+	if err != nil {
+		return fmt.Errorf("CompositePathMap: %w", err)
+	}
+	maps.Clear(pm)
+	maps.Copy(pm, leaves)
 	for _, v := range pmList {
-		err := mergePathMapValue(pm, v)
+		leaves, err := ExpandLeavesWithKeys(v, listKeys)
+		if err != nil {
+			return fmt.Errorf("CompositePathMap: %w", err)
+		}
+		err = mergePathMapValue(pm, leaves)
 		if err != nil {
 			return fmt.Errorf("CompositePathMap: %w", err)
 		}
@@ -130,48 +272,274 @@ func (pm PathMap) Composite(pmList []PathMapInterface) error {
 }
 
 type PathMapValue struct {
-	path   []string
-	value  any
-	option map[string]string
+	path       []string
+	value      any
+	option     map[string]string
+	provenance *Provenance
 }
 
+// NewPathMapValue accepts a leaf, a leaf-list, a container (orderedmap.OrderedMap) or list entries ([]interface{} of orderedmap.OrderedMap).
+// Containers and lists decoded as map[string]interface{} and []interface{} are converted.
 func NewPathMapValue(path []string, value any, option map[string]string) (*PathMapValue, error) {
+	v, err := normalizeValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("checkTypeForPathMapValue: %w", err)
+	}
+	return &PathMapValue{path: path, value: v, option: option}, nil
+}
+
+func NewPathMapValueSafe(path []string, value any, option map[string]string) *PathMapValue {
+	v, err := normalizeValue(value)
+	if err != nil {
+		return nil
+	}
+	return &PathMapValue{path: path, value: v, option: option}
+}
+
+func normalizeValue(value any) (any, error) {
 	switch v := value.(type) {
-	case bool, int, float64, uint, string, []bool, []int, []float64, []uint, []string:
-		return &PathMapValue{path: path, value: v, option: option}, nil
+	case bool, int, float64, uint, string, int64, uint64, json.Number,
+		[]bool, []int, []float64, []uint, []string, []int64, []uint64, []json.Number:
+		return v, nil
+	case iomap.OrderedMap:
+		return normalizeContainer(v)
+	case *iomap.OrderedMap:
+		return normalizeContainer(*v)
+	case map[string]interface{}:
+		keys := maps.Keys(v)
+		sort.Strings(keys)
+		container := iomap.New()
+		for _, k := range keys {
+			container.Set(k, v[k])
+		}
+		return normalizeContainer(*container)
+	case []interface{}:
+		return normalizeList(v)
 	default:
-		return nil, fmt.Errorf("checkTypeForPathMapValue: noexpected pahtmap value %v type: %t", v, v)
+		return nil, fmt.Errorf("noexpected pahtmap value %v type: %T", v, v)
 	}
 }
 
-func NewPathMapValueSafe(path []string, value any, option map[string]string) *PathMapValue {
+func normalizeContainer(v iomap.OrderedMap) (iomap.OrderedMap, error) {
+	result := iomap.New()
+	for _, k := range v.Keys() {
+		child, _ := v.Get(k)
+		switch vv := child.(type) {
+		case iomap.OrderedMap, *iomap.OrderedMap, map[string]interface{}:
+			normalized, err := normalizeValue(vv)
+			if err != nil {
+				return *result, err
+			}
+			result.Set(k, normalized)
+		case []interface{}:
+			// leaf-lists inside a container keep the decoded JSON form
+			if len(vv) == 0 || !isEntry(vv[0]) {
+				result.Set(k, vv)
+				continue
+			}
+			normalized, err := normalizeList(vv)
+			if err != nil {
+				return *result, err
+			}
+			result.Set(k, normalized)
+		default:
+			result.Set(k, vv)
+		}
+	}
+	return *result, nil
+}
+
+// normalizeList converts a decoded JSON array into list entries or a typed leaf-list.
+func normalizeList(v []interface{}) (any, error) {
+	if len(v) == 0 {
+		return []string{}, nil
+	}
+	if isEntry(v[0]) {
+		result := make([]interface{}, 0, len(v))
+		for _, elm := range v {
+			if !isEntry(elm) {
+				return nil, fmt.Errorf("noexpected list entry %v type: %T", elm, elm)
+			}
+			entry, err := normalizeValue(elm)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, entry)
+		}
+		return result, nil
+	}
+	switch v[0].(type) {
+	case string:
+		return toTypedList[string](v)
+	case float64:
+		return toTypedList[float64](v)
+	case int:
+		return toTypedList[int](v)
+	case uint:
+		return toTypedList[uint](v)
+	case bool:
+		return toTypedList[bool](v)
+	case json.Number:
+		return toTypedList[json.Number](v)
+	case int64:
+		return toTypedList[int64](v)
+	case uint64:
+		return toTypedList[uint64](v)
+	default:
+		return nil, fmt.Errorf("noexpected pahtmap value %v type: %T", v, v)
+	}
+}
+
+func toTypedList[T pathMapValueType](v []interface{}) ([]T, error) {
+	result := make([]T, 0, len(v))
+	for _, elm := range v {
+		typed, ok := elm.(T)
+		if !ok {
+			return nil, fmt.Errorf("noexpected leaf-list %v", v)
+		}
+		result = append(result, typed)
+	}
+	return result, nil
+}
+
+func isEntry(v any) bool {
+	switch v.(type) {
+	case iomap.OrderedMap, *iomap.OrderedMap, map[string]interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExpandLeaves returns a copy of pm whose container and list values are replaced by their leaves.
+// An empty container and a value with operation=replace or delete are kept as they are.
+// A list entry is addressed by the keys in the predicates of the paths of pm.
+func ExpandLeaves(pm PathMapInterface) (PathMap, error) {
+	listKeys, err := LearnListKeys(nil, pm)
+	if err != nil {
+		return nil, fmt.Errorf("ExpandLeaves: %w", err)
+	}
+	return ExpandLeavesWithKeys(pm, listKeys)
+}
+
+// LearnListKeys returns a copy of listKeys with the key names in the predicates of the paths of pms
+// for the lists not in listKeys, so that the values of pms are expanded with the same list keys.
+func LearnListKeys(listKeys yangpath.ListKeys, pms ...PathMapInterface) (yangpath.ListKeys, error) {
+	result := make(yangpath.ListKeys)
+	maps.Copy(result, listKeys)
+	for _, pm := range pms {
+		for _, path := range pm.GetKeys() {
+			segments, err := SplitPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("LearnListKeys: %w", err)
+			}
+			for i, v := range segments {
+				segment, err := yangpath.ParseSegment(v)
+				if err != nil {
+					return nil, fmt.Errorf("LearnListKeys: %w", err)
+				}
+				if !segment.IsListEntry() {
+					continue
+				}
+				schemaPath, err := yangpath.SchemaPath(yangpath.JoinPath(segments[:i+1]))
+				if err != nil {
+					return nil, fmt.Errorf("LearnListKeys: %w", err)
+				}
+				if _, ok := result[schemaPath]; ok {
+					continue
+				}
+				keyNames := make([]string, 0, len(segment.Keys))
+				for _, key := range segment.Keys {
+					keyNames = append(keyNames, key.Name)
+				}
+				result[schemaPath] = keyNames
+			}
+		}
+	}
+	return result, nil
+}
+
+// ExpandLeavesWithKeys is ExpandLeaves addressing a list entry by the keys of its list in listKeys.
+func ExpandLeavesWithKeys(pm PathMapInterface, listKeys yangpath.ListKeys) (PathMap, error) {
+	result := make(PathMap)
+	for _, path := range pm.GetKeys() {
+		value, _ := pm.GetValue(path)
+		option, _ := pm.GetOption(path)
+		leaves := make(PathMap)
+		if err := expandValue(path, value, option, listKeys, leaves); err != nil {
+			return nil, fmt.Errorf("ExpandLeaves: %w", err)
+		}
+		// the leaves of a value are owned by the services owning the value
+		provenance, _ := pm.GetProvenance(path)
+		for k, v := range leaves {
+			v.provenance = provenance
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+func expandValue(path string, value any, option map[string]string, listKeys yangpath.ListKeys, result PathMap) error {
+	if option == nil {
+		option = make(map[string]string)
+	}
+	if IsAtomic(option) {
+		return result.SetValue(path, value, option)
+	}
+	var parentPath string
+	var tree *iomap.OrderedMap
 	switch v := value.(type) {
-	case bool, int, float64, uint, string, []bool, []int, []float64, []uint, []string:
-		return &PathMapValue{path: path, value: v, option: option}
+	case iomap.OrderedMap:
+		if len(v.Keys()) == 0 {
+			return result.SetValue(path, v, option)
+		}
+		parentPath, tree = path, &v
+	case []interface{}:
+		keys, err := SplitPath(path)
+		if err != nil {
+			return err
+		}
+		tree = iomap.New()
+		tree.Set(keys[len(keys)-1], v)
+		parentPath = yangpath.JoinPath(keys[:len(keys)-1])
 	default:
-		return nil
+		return result.SetValue(path, value, option)
+	}
+	leaves, err := orderedmap.Flatten(parentPath, tree, listKeys)
+	if err != nil {
+		return err
 	}
+	for leafPath, leaf := range leaves {
+		if err := result.SetValue(leafPath, leaf, option); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type DiffResult struct {
 	Create PathMap
 	Update PathMap
 	Delete PathMap
+	// Previous holds the old values of the paths in Update so that a leaf-list is edited as a set delta.
+	Previous PathMap
 }
 
 func NewDiffResult() *DiffResult {
 	c, _ := NewPathMap(make(map[string]interface{}))
 	u, _ := NewPathMap(make(map[string]interface{}))
 	d, _ := NewPathMap(make(map[string]interface{}))
+	p, _ := NewPathMap(make(map[string]interface{}))
 	return &DiffResult{
-		Create: c,
-		Update: u,
-		Delete: d,
+		Create:   c,
+		Update:   u,
+		Delete:   d,
+		Previous: p,
 	}
 }
 
 type pathMapValueType interface {
-	bool | int | float64 | uint | string
+	bool | int | float64 | uint | string | int64 | uint64 | json.Number
 }
 
 func mergeList[T pathMapValueType](x, y []T) []T {
@@ -193,56 +561,33 @@ func mergeList[T pathMapValueType](x, y []T) []T {
 
 func checkConflictOrMergeListForPathMapValue(x, y any) (any, error) {
 	switch vx := x.(type) {
-	case bool, int, float64, uint, string:
-		if reflect.DeepEqual(x, y) {
+	case bool, int, float64, uint, string, int64, uint64, json.Number:
+		if EqualValue(x, y) {
 			return vx, nil
 		}
 		return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: conflict error %v : %v", x, y)
-	case []bool:
-		vy, ok := y.([]bool)
-		if !ok {
-			return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: conflict error %v : %v", x, y)
-		}
-		if reflect.DeepEqual(vx, vy) {
+	case iomap.OrderedMap, []interface{}:
+		// empty containers and the values replaced as a whole are left after ExpandLeaves
+		if EqualValue(x, y) {
 			return vx, nil
 		}
-		return mergeList(vx, vy), nil
+		return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: conflict error %v : %v", x, y)
+	case []bool:
+		return mergeLeafList(vx, y)
 	case []int:
-		vy, ok := y.([]int)
-		if !ok {
-			return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: conflict error %v : %v", x, y)
-		}
-		if reflect.DeepEqual(vx, vy) {
-			return vx, nil
-		}
-		return mergeList(vx, vy), nil
+		return mergeLeafList(vx, y)
 	case []float64:
-		vy, ok := y.([]float64)
-		if !ok {
-			return nil, fmt.Errorf("chackTypeAndConflictForPathMapValue: conflict error %v : %v", x, y)
-		}
-		if reflect.DeepEqual(vx, vy) {
-			return vx, nil
-		}
-		return mergeList(vx, vy), nil
+		return mergeLeafList(vx, y)
 	case []uint:
-		vy, ok := y.([]uint)
-		if !ok {
-			return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: conflict error %v : %v", x, y)
-		}
-		if reflect.DeepEqual(vx, vy) {
-			return vx, nil
-		}
-		return mergeList(vx, vy), nil
+		return mergeLeafList(vx, y)
 	case []string:
-		vy, ok := y.([]string)
-		if !ok {
-			return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: conflict error %v : %v", x, y)
-		}
-		if reflect.DeepEqual(vx, vy) {
-			return vx, nil
-		}
-		return mergeList(vx, vy), nil
+		return mergeLeafList(vx, y)
+	case []int64:
+		return mergeLeafList(vx, y)
+	case []uint64:
+		return mergeLeafList(vx, y)
+	case []json.Number:
+		return mergeLeafList(vx, y)
 	default:
 		return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: noexpected pahtmap value %v type: %t", vx, vx)
 	}
@@ -257,7 +602,8 @@ func mergePathMapValue(x PathMapInterface, y PathMapInterface) error {
 				return fmt.Errorf("mergePathMapValue: %w", err)
 			}
 			y.DeleteValue(path)
-			err = x.SetValue(path, resultValue, make(map[string]string))
+			xo, _ := x.GetOption(path)
+			err = x.SetValue(path, resultValue, xo)
 			if err != nil {
 				return fmt.Errorf("mergePathMapValue: %w", err)
 			}
@@ -267,7 +613,8 @@ func mergePathMapValue(x PathMapInterface, y PathMapInterface) error {
 		if err != nil {
 			return fmt.Errorf("mergePathMapValue: %w", err)
 		}
-		err = x.SetValue(path, resultValue, make(map[string]string))
+		xo, _ := x.GetOption(path)
+		err = x.SetValue(path, resultValue, xo)
 		if err != nil {
 			return fmt.Errorf("mergePathMapValue: %w", err)
 		}
@@ -278,7 +625,8 @@ func mergePathMapValue(x PathMapInterface, y PathMapInterface) error {
 		if err != nil {
 			return fmt.Errorf("mergePathMapValue: %w", err)
 		}
-		err = x.SetValue(path, resultValue, make(map[string]string))
+		yo, _ := y.GetOption(path)
+		err = x.SetValue(path, resultValue, yo)
 		if err != nil {
 			return fmt.Errorf("mergePathMapValue: %w", err)
 		}
@@ -0,0 +1,119 @@
+package pathmap
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"golang.org/x/exp/maps"
+)
+
+// Provenance is the set of services owning the composed value of a path.
+type Provenance struct {
+	Services []string `json:"services"`
+	// Elements holds the services of each element of a merged leaf-list.
+	Elements map[string][]string `json:"elements,omitempty"`
+}
+
+// NewProvenance returns the provenance of the value composed from contributions. A service owns a leaf
+// whose value is equal to its contribution, and an element of a leaf-list that its contribution contains.
+func NewProvenance(value any, contributions []Contribution) *Provenance {
+	result := &Provenance{Services: make([]string, 0)}
+	rv := reflect.ValueOf(value)
+	// list entries replaced as a whole are owned like a leaf
+	if _, ok := value.([]interface{}); ok || rv.Kind() != reflect.Slice {
+		for _, c := range contributions {
+			if EqualValue(value, c.Value) {
+				result.Services = appendService(result.Services, c.Service)
+			}
+		}
+		return result
+	}
+	result.Elements = make(map[string][]string)
+	for i := 0; i < rv.Len(); i++ {
+		element := rv.Index(i).Interface()
+		key := elementKey(element)
+		result.Elements[key] = make([]string, 0)
+		for _, c := range contributions {
+			if containsElement(c.Value, element) {
+				result.Elements[key] = appendService(result.Elements[key], c.Service)
+				result.Services = appendService(result.Services, c.Service)
+			}
+		}
+	}
+	return result
+}
+
+func containsElement(list any, element any) bool {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if EqualValue(rv.Index(i).Interface(), element) {
+			return true
+		}
+	}
+	return false
+}
+
+// elementKey returns the key of a leaf-list element in Provenance.Elements.
+func elementKey(element any) string {
+	if _, ok := number(element); ok {
+		return numberString(element).String()
+	}
+	return fmt.Sprintf("%v", element)
+}
+
+func appendService(services []string, service string) []string {
+	i := sort.SearchStrings(services, service)
+	if i < len(services) && services[i] == service {
+		return services
+	}
+	services = append(services, "")
+	copy(services[i+1:], services[i:])
+	services[i] = service
+	return services
+}
+
+// Owners returns the services owning path: the owners of path itself or of its nearest ancestor.
+type Owners func(path string) []string
+
+// NewOwners returns the Owners of the paths of serviceToPathmaps, the ref.json of a device. Every pathmap is
+// taken into account so that a path owned before a change is still owned while it is being deleted.
+// A service owns the leaves of its container and list values, whose list entries are addressed by listKeys.
+func NewOwners(listKeys yangpath.ListKeys, serviceToPathmaps ...map[string]PathMapInterface) (Owners, error) {
+	pms := make([]PathMapInterface, 0)
+	for _, serviceToPathmap := range serviceToPathmaps {
+		pms = append(pms, maps.Values(serviceToPathmap)...)
+	}
+	listKeys, err := LearnListKeys(listKeys, pms...)
+	if err != nil {
+		return nil, fmt.Errorf("NewOwners: %w", err)
+	}
+	owners := make(map[string][]string)
+	for _, serviceToPathmap := range serviceToPathmaps {
+		for serviceName, pm := range serviceToPathmap {
+			leaves, err := ExpandLeavesWithKeys(pm, listKeys)
+			if err != nil {
+				return nil, fmt.Errorf("NewOwners: %w", err)
+			}
+			for _, path := range append(pm.GetKeys(), leaves.GetKeys()...) {
+				owners[path] = appendService(owners[path], serviceName)
+			}
+		}
+	}
+	return func(path string) []string {
+		keys, err := yangpath.SplitPath(path)
+		if err != nil {
+			return nil
+		}
+		for i := len(keys); i > 0; i-- {
+			if services, ok := owners[yangpath.JoinPath(keys[:i])]; ok {
+				return append(make([]string, 0, len(services)), services...)
+			}
+		}
+		return nil
+	}, nil
+}
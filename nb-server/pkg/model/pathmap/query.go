@@ -0,0 +1,129 @@
+package pathmap
+
+import (
+	"fmt"
+
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+)
+
+// Query returns the values at or under the paths matching pattern, such as
+// /interfaces/interface[name=*]/config/mtu or / for every value.
+// A segment name or key value * matches anything, and a segment without key predicates matches every list entry.
+// A container or list value holding a matching path is expanded to return only its matching leaves.
+func (pm PathMap) Query(pattern string) (PathMap, error) {
+	patternSegments, err := parsePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Query: %w", err)
+	}
+	result := make(PathMap)
+	for path, v := range pm {
+		matched, leaves, err := matchValue(path, v, patternSegments)
+		if err != nil {
+			return nil, fmt.Errorf("Query: %w", err)
+		}
+		if matched {
+			result[path] = v
+		}
+		for leafPath, leaf := range leaves {
+			result[leafPath] = leaf
+		}
+	}
+	return result, nil
+}
+
+// DeleteSubtree deletes the values Query returns for pattern and returns the number of deleted paths.
+// The other leaves of an expanded container or list value are kept as separate paths.
+func (pm PathMap) DeleteSubtree(pattern string) (int, error) {
+	patternSegments, err := parsePattern(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("DeleteSubtree: %w", err)
+	}
+	count := 0
+	for _, path := range pm.GetKeys() {
+		v := pm[path]
+		matched, leaves, err := matchValue(path, v, patternSegments)
+		if err != nil {
+			return 0, fmt.Errorf("DeleteSubtree: %w", err)
+		}
+		if matched {
+			delete(pm, path)
+			count++
+			continue
+		}
+		if len(leaves) == 0 {
+			continue
+		}
+		expanded, err := ExpandLeaves(PathMap{path: v})
+		if err != nil {
+			return 0, fmt.Errorf("DeleteSubtree: %w", err)
+		}
+		delete(pm, path)
+		for leafPath, leaf := range expanded {
+			if _, ok := leaves[leafPath]; ok {
+				count++
+				continue
+			}
+			pm[leafPath] = leaf
+		}
+	}
+	return count, nil
+}
+
+func parsePattern(pattern string) ([]yangpath.Segment, error) {
+	result := make([]yangpath.Segment, 0)
+	if pattern == "/" {
+		return result, nil
+	}
+	segments, err := SplitPath(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range segments {
+		segment, _ := yangpath.ParseSegment(v)
+		result = append(result, segment)
+	}
+	return result, nil
+}
+
+// matchValue reports whether path is at or under a path matching pattern. If path is above the pattern,
+// the matching leaves of its value are returned instead.
+func matchValue(path string, v *PathMapValue, pattern []yangpath.Segment) (bool, PathMap, error) {
+	segments := make([]yangpath.Segment, 0, len(v.path))
+	for _, s := range v.path {
+		segment, err := yangpath.ParseSegment(s)
+		if err != nil {
+			return false, nil, err
+		}
+		segments = append(segments, segment)
+	}
+	n := len(pattern)
+	if len(segments) < n {
+		n = len(segments)
+	}
+	for i := 0; i < n; i++ {
+		if !yangpath.MatchSegment(pattern[i], segments[i]) {
+			return false, nil, nil
+		}
+	}
+	if len(segments) >= len(pattern) {
+		return true, nil, nil
+	}
+	leaves, err := ExpandLeaves(PathMap{path: v})
+	if err != nil {
+		return false, nil, err
+	}
+	result := make(PathMap)
+	for leafPath, leaf := range leaves {
+		if leafPath == path {
+			continue
+		}
+		matched, _, err := matchValue(leafPath, leaf, pattern)
+		if err != nil {
+			return false, nil, err
+		}
+		if matched {
+			result[leafPath] = leaf
+		}
+	}
+	return false, result, nil
+}
@@ -0,0 +1,84 @@
+package pathmap
+
+import (
+	"encoding/json"
+	"testing"
+
+	iomap "github.com/iancoleman/orderedmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func newQueryPathMap(t *testing.T) PathMap {
+	pm, _ := NewPathMap(make(map[string]interface{}))
+	assert.Nil(t, pm.SetValue("/interfaces/interface[name=eth0]/mtu", 1500, make(map[string]string)))
+	assert.Nil(t, pm.SetValue("/interfaces/interface[name=eth0]/description", "uplink", make(map[string]string)))
+	assert.Nil(t, pm.SetValue("/interfaces/interface[name=eth1]/mtu", 9000, make(map[string]string)))
+	entries := iomap.New()
+	assert.Nil(t, json.Unmarshal([]byte(`{"vlan":[{"id":"10","name":"a"},{"id":"20","name":"b"}]}`), entries))
+	assert.Nil(t, pm.SetValue("/vlans", *entries, make(map[string]string)))
+	return pm
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		pattern string
+		want    []string
+		wantErr bool
+	}
+	tests := map[string]test{
+		"正常系: 部分木": {
+			pattern: "/interfaces/interface[name=eth0]",
+			want:    []string{"/interfaces/interface[name=eth0]/mtu", "/interfaces/interface[name=eth0]/description"},
+		},
+		"正常系: キーのワイルドカード": {
+			pattern: "/interfaces/interface[name=*]/mtu",
+			want:    []string{"/interfaces/interface[name=eth0]/mtu", "/interfaces/interface[name=eth1]/mtu"},
+		},
+		"正常系: 名前のワイルドカード": {
+			pattern: "/interfaces/*/description",
+			want:    []string{"/interfaces/interface[name=eth0]/description"},
+		},
+		"正常系: コンテナ値の中を検索": {
+			pattern: "/vlans/vlan[id=20]",
+			want:    []string{"/vlans/vlan[id=20]/id", "/vlans/vlan[id=20]/name"},
+		},
+		"正常系: ルート": {
+			pattern: "/",
+			want:    []string{"/interfaces/interface[name=eth0]/mtu", "/interfaces/interface[name=eth0]/description", "/interfaces/interface[name=eth1]/mtu", "/vlans"},
+		},
+		"異常系: 不正なパス": {
+			pattern: "/interfaces//mtu",
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newQueryPathMap(t).Query(tt.pattern)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, tt.want, got.GetKeys())
+		})
+	}
+}
+
+func TestDeleteSubtree(t *testing.T) {
+	t.Parallel()
+	pm := newQueryPathMap(t)
+	count, err := pm.DeleteSubtree("/interfaces/interface[name=*]/mtu")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	count, err = pm.DeleteSubtree("/vlans/vlan[id=10]")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, map[string]interface{}{
+		"/interfaces/interface[name=eth0]/description": "uplink",
+		"/vlans/vlan[id=20]/id":                        "20",
+		"/vlans/vlan[id=20]/name":                      "b",
+	}, pm.GetMapInterface())
+}
@@ -0,0 +1,169 @@
+package pathmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	OPTION_CONFLICT_POLICY = "conflict-policy"
+	// an integer, the highest priority wins under CONFLICT_POLICY_PRIORITY
+	OPTION_PRIORITY = "priority"
+)
+
+const (
+	CONFLICT_POLICY_ERROR            = "error"
+	CONFLICT_POLICY_PRIORITY         = "priority"
+	CONFLICT_POLICY_LAST_WRITER_WINS = "last-writer-wins"
+)
+
+// Contribution is the value a service sets to a single path.
+type Contribution struct {
+	Service string
+	Value   any
+	Option  map[string]string
+}
+
+// Resolution records the service whose value wins a contested leaf.
+type Resolution struct {
+	Device   string   `json:"device"`
+	Path     string   `json:"path"`
+	Policy   string   `json:"policy"`
+	Winner   string   `json:"winner"`
+	Value    any      `json:"value"`
+	Services []string `json:"services"`
+}
+
+// Conflict is a leaf set to different values by services that could not be resolved.
+type Conflict struct {
+	Device   string   `json:"device"`
+	Path     string   `json:"path"`
+	Values   []any    `json:"values"`
+	Services []string `json:"services"`
+	Reason   string   `json:"reason"`
+}
+
+// ConflictError holds every conflict found while composing pathmaps.
+type ConflictError struct {
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+func (e *ConflictError) Error() string {
+	messages := make([]string, 0, len(e.Conflicts))
+	for _, v := range e.Conflicts {
+		messages = append(messages, fmt.Sprintf("%v %v: %v between %v: %v", v.Device, v.Path, v.Values, v.Services, v.Reason))
+	}
+	return fmt.Sprintf("conflict error: %v", strings.Join(messages, "; "))
+}
+
+// Resolve merges the contributions to path, which are ordered from the oldest writer to the latest.
+// Equal values and leaf-lists are merged as Composite does. Different scalar values are resolved by the
+// conflict policy of the contributions, and the returned Resolution is nil unless a winner was chosen.
+// A leaf that cannot be resolved is returned as a *ConflictError.
+func Resolve(path string, contributions []Contribution) (any, *Resolution, error) {
+	if len(contributions) == 0 {
+		return nil, nil, fmt.Errorf("Resolve: no contribution to %v", path)
+	}
+	services := make([]string, 0, len(contributions))
+	for _, c := range contributions {
+		services = append(services, c.Service)
+	}
+	conflict := func(reason string) error {
+		return &ConflictError{Conflicts: []Conflict{{Path: path, Values: values(contributions), Services: services, Reason: reason}}}
+	}
+	for _, c := range contributions[1:] {
+		if Operation(c.Option) != Operation(contributions[0].Option) {
+			return nil, nil, conflict("different operations")
+		}
+	}
+	value, err := checkConflictOrMergeListForPathMapValue(contributions[0].Value, contributions[0].Value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Resolve: %w", err)
+	}
+	contested := false
+	for _, c := range contributions[1:] {
+		merged, err := checkConflictOrMergeListForPathMapValue(value, c.Value)
+		if err != nil {
+			contested = true
+			break
+		}
+		value = merged
+	}
+	if !contested {
+		return value, nil, nil
+	}
+	policy, err := conflictPolicy(contributions)
+	if err != nil {
+		return nil, nil, conflict(err.Error())
+	}
+	var winner *Contribution
+	switch policy {
+	case CONFLICT_POLICY_LAST_WRITER_WINS:
+		winner = &contributions[len(contributions)-1]
+	case CONFLICT_POLICY_PRIORITY:
+		winner, err = highestPriority(contributions)
+		if err != nil {
+			return nil, nil, conflict(err.Error())
+		}
+	default:
+		return nil, nil, conflict("different values without a conflict policy")
+	}
+	return winner.Value, &Resolution{Path: path, Policy: policy, Winner: winner.Service, Value: winner.Value, Services: services}, nil
+}
+
+// conflictPolicy returns the policy shared by all contributions. Contributions without a policy follow the others.
+func conflictPolicy(contributions []Contribution) (string, error) {
+	policy := ""
+	for _, c := range contributions {
+		v := c.Option[OPTION_CONFLICT_POLICY]
+		switch v {
+		case "":
+			continue
+		case CONFLICT_POLICY_ERROR, CONFLICT_POLICY_PRIORITY, CONFLICT_POLICY_LAST_WRITER_WINS:
+		default:
+			return "", fmt.Errorf("noexpected conflict policy %v of %v", v, c.Service)
+		}
+		if policy != "" && policy != v {
+			return "", fmt.Errorf("conflict policies differ between services: %v, %v", policy, v)
+		}
+		policy = v
+	}
+	if policy == "" {
+		return CONFLICT_POLICY_ERROR, nil
+	}
+	return policy, nil
+}
+
+func highestPriority(contributions []Contribution) (*Contribution, error) {
+	var winner *Contribution
+	highest, tie := 0, false
+	for i, c := range contributions {
+		priority := 0
+		if v, ok := c.Option[OPTION_PRIORITY]; ok {
+			p, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("noexpected priority %v of %v", v, c.Service)
+			}
+			priority = p
+		}
+		switch {
+		case winner == nil || priority > highest:
+			winner, highest, tie = &contributions[i], priority, false
+		case priority == highest && !EqualValue(winner.Value, c.Value):
+			tie = true
+		}
+	}
+	if tie {
+		return nil, fmt.Errorf("same priority %v for different values", highest)
+	}
+	return winner, nil
+}
+
+func values(contributions []Contribution) []any {
+	result := make([]any, 0, len(contributions))
+	for _, c := range contributions {
+		result = append(result, c.Value)
+	}
+	return result
+}
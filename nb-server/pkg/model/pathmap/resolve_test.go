@@ -0,0 +1,62 @@
+package pathmap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveForPriority(t *testing.T) {
+	t.Parallel()
+	priority := func(p string) map[string]string {
+		return map[string]string{OPTION_CONFLICT_POLICY: CONFLICT_POLICY_PRIORITY, OPTION_PRIORITY: p}
+	}
+	type test struct {
+		contributions []Contribution
+		want          any
+		wantWinner    string
+		wantErr       bool
+	}
+	tests := map[string]test{
+		"正常系: 最も高い優先度の値": {
+			contributions: []Contribution{
+				{Service: "serviceA", Value: 1500, Option: priority("1")},
+				{Service: "serviceB", Value: 9000, Option: priority("10")},
+			},
+			want:       9000,
+			wantWinner: "serviceB",
+		},
+		"正常系: 同じ優先度で型の異なる等しい数値": {
+			contributions: []Contribution{
+				{Service: "serviceA", Value: 9000, Option: priority("10")},
+				{Service: "serviceB", Value: json.Number("9000"), Option: priority("10")},
+				{Service: "serviceC", Value: 1500, Option: priority("1")},
+			},
+			want:       9000,
+			wantWinner: "serviceA",
+		},
+		"異常系: 同じ優先度で異なる値": {
+			contributions: []Contribution{
+				{Service: "serviceA", Value: 9000, Option: priority("10")},
+				{Service: "serviceB", Value: 1500, Option: priority("10")},
+			},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, resolution, err := Resolve("/mtu", tt.contributions)
+			if tt.wantErr {
+				var conflictErr *ConflictError
+				assert.ErrorAs(t, err, &conflictErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantWinner, resolution.Winner)
+		})
+	}
+}
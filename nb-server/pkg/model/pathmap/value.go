@@ -0,0 +1,220 @@
+package pathmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	iomap "github.com/iancoleman/orderedmap"
+)
+
+// number returns the exact value of a numeric pathmap value. A float is read as its shortest decimal form
+// so that 0.1 decoded from JSON equals the decimal64 0.1.
+func number(v any) (*big.Rat, bool) {
+	var s string
+	switch vv := v.(type) {
+	case int:
+		s = strconv.FormatInt(int64(vv), 10)
+	case int64:
+		s = strconv.FormatInt(vv, 10)
+	case uint:
+		s = strconv.FormatUint(uint64(vv), 10)
+	case uint64:
+		s = strconv.FormatUint(vv, 10)
+	case float64:
+		s = strconv.FormatFloat(vv, 'g', -1, 64)
+	case json.Number:
+		s = vv.String()
+	default:
+		return nil, false
+	}
+	result, ok := new(big.Rat).SetString(s)
+	return result, ok
+}
+
+// numberString returns a numeric value as a json.Number.
+func numberString(v any) json.Number {
+	if f, ok := v.(float64); ok {
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Number(fmt.Sprintf("%v", v))
+}
+
+// EqualValue reports whether two pathmap values are equal regardless of the Go type of their numbers,
+// such as the int of a TF logic and the json.Number reloaded from git. The order of container keys is ignored.
+func EqualValue(x, y any) bool {
+	if nx, ok := number(x); ok {
+		ny, ok := number(y)
+		return ok && nx.Cmp(ny) == 0
+	}
+	if vx, ok := x.(iomap.OrderedMap); ok {
+		vy, ok := y.(iomap.OrderedMap)
+		if !ok || len(vx.Keys()) != len(vy.Keys()) {
+			return false
+		}
+		for _, k := range vx.Keys() {
+			cx, _ := vx.Get(k)
+			cy, ok := vy.Get(k)
+			if !ok || !EqualValue(cx, cy) {
+				return false
+			}
+		}
+		return true
+	}
+	rx, ry := reflect.ValueOf(x), reflect.ValueOf(y)
+	if rx.Kind() == reflect.Slice && ry.Kind() == reflect.Slice {
+		if rx.Len() != ry.Len() {
+			return false
+		}
+		for i := 0; i < rx.Len(); i++ {
+			if !EqualValue(rx.Index(i).Interface(), ry.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func isNumberList(v any) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if _, ok := number(rv.Index(i).Interface()); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLeafList merges the leaf-list y into x. Numeric leaf-lists of different types are merged into
+// a []json.Number without the numbers equal to a number already in the list.
+func mergeLeafList[T pathMapValueType](x []T, y any) (any, error) {
+	if EqualValue(x, y) {
+		return x, nil
+	}
+	if vy, ok := y.([]T); ok {
+		return mergeList(x, vy), nil
+	}
+	if !isNumberList(x) || !isNumberList(y) {
+		return nil, fmt.Errorf("checkConflictOrMergeListForPathMapValue: conflict error %v : %v", x, y)
+	}
+	result := make([]json.Number, 0)
+	seen := make([]*big.Rat, 0)
+	ry := reflect.ValueOf(y)
+	elements := make([]any, 0, len(x)+ry.Len())
+	for _, v := range x {
+		elements = append(elements, v)
+	}
+	for i := 0; i < ry.Len(); i++ {
+		elements = append(elements, ry.Index(i).Interface())
+	}
+	for _, v := range elements {
+		n, _ := number(v)
+		duplicated := false
+		for _, s := range seen {
+			if s.Cmp(n) == 0 {
+				duplicated = true
+				break
+			}
+		}
+		if duplicated {
+			continue
+		}
+		seen = append(seen, n)
+		result = append(result, numberString(v))
+	}
+	return result, nil
+}
+
+// IsLeafList reports whether value is a leaf-list, a slice whose elements are not list entries.
+func IsLeafList(value any) bool {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if isEntry(rv.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// LeafListDelta applies the change of a leaf-list from previous to next to current, the leaf-list on the device,
+// as a set delta: the elements of previous not in next are removed and the elements of next not in current are
+// appended. The other elements of current, which no service contributed, are kept in their order.
+// previous and current may be nil.
+func LeafListDelta(current any, previous any, next any) []interface{} {
+	result := make([]interface{}, 0)
+	rc := reflect.ValueOf(current)
+	if rc.Kind() == reflect.Slice {
+		for i := 0; i < rc.Len(); i++ {
+			element := rc.Index(i).Interface()
+			if containsElement(previous, element) && !containsElement(next, element) {
+				continue
+			}
+			result = append(result, element)
+		}
+	}
+	rn := reflect.ValueOf(next)
+	if rn.Kind() == reflect.Slice {
+		for i := 0; i < rn.Len(); i++ {
+			element := rn.Index(i).Interface()
+			if !containsElement(result, element) {
+				result = append(result, element)
+			}
+		}
+	}
+	return result
+}
+
+// OrderLeafList returns a copy of list whose elements in order are moved to the positions they take in list
+// in the order of order. The other elements of list are kept in their positions.
+func OrderLeafList(list []interface{}, order any) []interface{} {
+	result := append(make([]interface{}, 0, len(list)), list...)
+	positions := make([]int, 0)
+	for i, element := range list {
+		if containsElement(order, element) {
+			positions = append(positions, i)
+		}
+	}
+	ordered := make([]interface{}, 0, len(positions))
+	ro := reflect.ValueOf(order)
+	if ro.Kind() == reflect.Slice {
+		for i := 0; i < ro.Len(); i++ {
+			element := ro.Index(i).Interface()
+			if containsElement(list, element) && !containsElement(ordered, element) {
+				ordered = append(ordered, element)
+			}
+		}
+	}
+	for i, position := range positions {
+		if i < len(ordered) {
+			result[position] = ordered[i]
+		}
+	}
+	return result
+}
+
+// isReorder reports whether a leaf-list with opt is changed from previous to next only in the order of its elements,
+// which is not a change of a leaf-list merged as a set delta unless it is ordered by the user.
+func isReorder(next any, previous any, opt map[string]string) bool {
+	if IsAtomic(opt) || IsOrderedByUser(opt) || !IsLeafList(next) || !IsLeafList(previous) {
+		return false
+	}
+	rn, rp := reflect.ValueOf(next), reflect.ValueOf(previous)
+	if rn.Len() != rp.Len() {
+		return false
+	}
+	for i := 0; i < rn.Len(); i++ {
+		if !containsElement(previous, rn.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
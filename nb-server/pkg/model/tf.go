@@ -17,6 +17,13 @@ func NewPathMapLogic() PathMapLogic {
 	return make(PathMapLogic, 0)
 }
 
+// ServiceOptions are the default pathmap options of every value of a service, such as its conflict policy and priority.
+type ServiceOptions map[string]map[string]string
+
+func NewServiceOptions() ServiceOptions {
+	return make(ServiceOptions, 0)
+}
+
 func NewServiceMap() ServiceMap {
 	return make(map[string]map[string]interface{}, 0)
 }
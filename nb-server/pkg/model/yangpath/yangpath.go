@@ -0,0 +1,252 @@
+package yangpath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Key is a key predicate of a list entry such as [name=value].
+type Key struct {
+	Name  string
+	Value string
+}
+
+// Segment is an element of a path: a container or leaf name, or a list name with its key predicates
+// such as route[prefix=10.0.0.0/8][next-hop=1.1.1.1].
+//
+// A key value is written as it is, or quoted with ' or " when it contains [ ] ' " or \.
+// In both forms a \ escapes the next character.
+type Segment struct {
+	Name string
+	Keys []Key
+}
+
+// ParseSegment parses a segment.
+func ParseSegment(s string) (Segment, error) {
+	result := Segment{}
+	i := strings.IndexByte(s, '[')
+	if i < 0 {
+		i = len(s)
+	}
+	result.Name = s[:i]
+	if result.Name == "" || strings.ContainsAny(result.Name, `]='"\`) {
+		return Segment{}, fmt.Errorf("ParseSegment: noexpected name in %v", s)
+	}
+	for i < len(s) {
+		key, n, err := parseKey(s[i:])
+		if err != nil {
+			return Segment{}, fmt.Errorf("ParseSegment: %v: %w", s, err)
+		}
+		if _, ok := result.KeyValue(key.Name); ok {
+			return Segment{}, fmt.Errorf("ParseSegment: duplicated key %v in %v", key.Name, s)
+		}
+		result.Keys = append(result.Keys, key)
+		i += n
+	}
+	return result, nil
+}
+
+// parseKey parses the predicate at the start of s and returns the number of bytes read.
+func parseKey(s string) (Key, int, error) {
+	if s[0] != '[' {
+		return Key{}, 0, fmt.Errorf("noexpected %v after a predicate", s)
+	}
+	eq := strings.IndexByte(s, '=')
+	if eq < 0 {
+		return Key{}, 0, fmt.Errorf("no = in predicate %v", s)
+	}
+	name := s[1:eq]
+	if name == "" || strings.ContainsAny(name, `[]'"\`) {
+		return Key{}, 0, fmt.Errorf("noexpected key name in predicate %v", s)
+	}
+	i := eq + 1
+	var quote byte
+	if i < len(s) && (s[i] == '\'' || s[i] == '"') {
+		quote = s[i]
+		i++
+	}
+	var value strings.Builder
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			if i+1 == len(s) {
+				return Key{}, 0, fmt.Errorf("escape at the end of %v", s)
+			}
+			i++
+			value.WriteByte(s[i])
+		case quote != 0 && c == quote:
+			if i+1 == len(s) || s[i+1] != ']' {
+				return Key{}, 0, fmt.Errorf("noexpected %v after the quoted value of %v", s[i+1:], name)
+			}
+			return Key{Name: name, Value: value.String()}, i + 2, nil
+		case quote == 0 && c == ']':
+			if value.Len() == 0 {
+				return Key{}, 0, fmt.Errorf("empty value of %v", name)
+			}
+			return Key{Name: name, Value: value.String()}, i + 1, nil
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return Key{}, 0, fmt.Errorf("unterminated predicate %v", s)
+}
+
+// String formats the segment so that ParseSegment returns it again.
+func (s Segment) String() string {
+	var b strings.Builder
+	b.WriteString(s.Name)
+	for _, v := range s.Keys {
+		b.WriteString("[")
+		b.WriteString(v.Name)
+		b.WriteString("=")
+		b.WriteString(FormatValue(v.Value))
+		b.WriteString("]")
+	}
+	return b.String()
+}
+
+// FormatValue returns value as a key predicate value, quoted if necessary.
+func FormatValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, `[]'"\`) {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// IsListEntry reports whether the segment selects a list entry.
+func (s Segment) IsListEntry() bool {
+	return len(s.Keys) != 0
+}
+
+// KeyValue returns the value of the key predicate name.
+func (s Segment) KeyValue(name string) (string, bool) {
+	for _, v := range s.Keys {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+// SplitPath splits an absolute path such as /interfaces/interface[name=GigabitEthernet0/0/1]/mtu into its segments.
+// A / inside a key predicate does not split the path, and the path is not cleaned: an empty segment is an error.
+func SplitPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("SplitPath: path %q is not absolute", path)
+	}
+	result := make([]string, 0)
+	start, depth := 1, 0
+	var quote byte
+	for i := 1; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case depth != 0 && (c == '\'' || c == '"') && path[i-1] == '=':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']' && depth != 0:
+			depth--
+		case c == '/' && depth == 0:
+			result = append(result, path[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 || depth != 0 {
+		return nil, fmt.Errorf("SplitPath: unterminated predicate in %q", path)
+	}
+	result = append(result, path[start:])
+	for _, v := range result {
+		if _, err := ParseSegment(v); err != nil {
+			return nil, fmt.Errorf("SplitPath: %q: %w", path, err)
+		}
+	}
+	return result, nil
+}
+
+// JoinPath returns the absolute path of segments.
+func JoinPath(segments []string) string {
+	return "/" + strings.Join(segments, "/")
+}
+
+// ListKeys maps the schema path of a list, such as /interfaces/interface, to the names of its keys.
+type ListKeys map[string][]string
+
+// Get returns the key names of the list at path. path may have key predicates and module prefixes.
+func (l ListKeys) Get(path string) []string {
+	if len(l) == 0 {
+		return nil
+	}
+	schemaPath, err := SchemaPath(path)
+	if err != nil {
+		return nil
+	}
+	return l[schemaPath]
+}
+
+// SchemaPath returns path without key predicates and module prefixes, such as /interfaces/interface
+// for /openconfig-interfaces:interfaces/interface[name=eth0].
+func SchemaPath(path string) (string, error) {
+	segments, err := SplitPath(path)
+	if err != nil {
+		return "", fmt.Errorf("SchemaPath: %w", err)
+	}
+	names := make([]string, 0, len(segments))
+	for _, v := range segments {
+		segment, err := ParseSegment(v)
+		if err != nil {
+			return "", fmt.Errorf("SchemaPath: %w", err)
+		}
+		_, name, ok := strings.Cut(segment.Name, ":")
+		if !ok {
+			name = segment.Name
+		}
+		names = append(names, name)
+	}
+	return JoinPath(names), nil
+}
+
+// WILDCARD matches any name or key value in a pattern segment.
+const WILDCARD = "*"
+
+// MatchSegment reports whether segment matches pattern. The name and key values of pattern may be WILDCARD,
+// and a pattern without key predicates matches every entry of a list.
+func MatchSegment(pattern Segment, segment Segment) bool {
+	if pattern.Name != WILDCARD && pattern.Name != segment.Name {
+		return false
+	}
+	for _, key := range pattern.Keys {
+		value, ok := segment.KeyValue(key.Name)
+		if !ok || (key.Value != WILDCARD && key.Value != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDescendant reports whether path is under parent. "/a/b[k=v]" is under "/a/b" and every path is under "/".
+func IsDescendant(path string, parent string) bool {
+	if parent == "/" {
+		return path != "/"
+	}
+	return strings.HasPrefix(path, parent+"/") || strings.HasPrefix(path, parent+"[")
+}
+
+// IsListKeyLeaf reports whether the last segment of segments is a key leaf of the list entry before it,
+// such as [..., "E[F=f]", "F"]. An entry is looked up by its key leaves, so they are deleted after its other leaves.
+func IsListKeyLeaf(segments []string) bool {
+	if len(segments) < 2 {
+		return false
+	}
+	segment, err := ParseSegment(segments[len(segments)-2])
+	if err != nil {
+		return false
+	}
+	_, ok := segment.KeyValue(segments[len(segments)-1])
+	return ok
+}
@@ -0,0 +1,207 @@
+package yangpath
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSegment(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		arg     string
+		want    Segment
+		format  string
+		wantErr bool
+	}
+	tests := map[string]test{
+		"正常系: コンテナ": {
+			arg:    "interfaces",
+			want:   Segment{Name: "interfaces"},
+			format: "interfaces",
+		},
+		"正常系: 複数キー": {
+			arg:    "route[prefix=10.0.0.0/8][next-hop=1.1.1.1]",
+			want:   Segment{Name: "route", Keys: []Key{{Name: "prefix", Value: "10.0.0.0/8"}, {Name: "next-hop", Value: "1.1.1.1"}}},
+			format: "route[prefix=10.0.0.0/8][next-hop=1.1.1.1]",
+		},
+		"正常系: 値に=を含む": {
+			arg:    "E[F=a=b]",
+			want:   Segment{Name: "E", Keys: []Key{{Name: "F", Value: "a=b"}}},
+			format: "E[F=a=b]",
+		},
+		"正常系: クォートした値": {
+			arg:    `E[F='a]b'][G="c\"d"]`,
+			want:   Segment{Name: "E", Keys: []Key{{Name: "F", Value: "a]b"}, {Name: "G", Value: `c"d`}}},
+			format: `E[F="a]b"][G="c\"d"]`,
+		},
+		"正常系: エスケープした値": {
+			arg:    `E[F=a\]b]`,
+			want:   Segment{Name: "E", Keys: []Key{{Name: "F", Value: "a]b"}}},
+			format: `E[F="a]b"]`,
+		},
+		"異常系: 名前がない": {
+			arg:     "[F=f]",
+			wantErr: true,
+		},
+		"異常系: 閉じていない": {
+			arg:     "E[F=f",
+			wantErr: true,
+		},
+		"異常系: 値が空": {
+			arg:     "E[F=]",
+			wantErr: true,
+		},
+		"異常系: キーの重複": {
+			arg:     "E[F=f0][F=f1]",
+			wantErr: true,
+		},
+		"異常系: 述語の後に文字": {
+			arg:     "E[F=f]G",
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseSegment(tt.arg)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.format, got.String())
+			again, err := ParseSegment(got.String())
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, again)
+		})
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		arg     string
+		want    []string
+		wantErr bool
+	}
+	tests := map[string]test{
+		"正常系: キーの値に/を含む": {
+			arg:  "/interfaces/interface[name=GigabitEthernet0/0/1]/config/mtu",
+			want: []string{"interfaces", "interface[name=GigabitEthernet0/0/1]", "config", "mtu"},
+		},
+		"正常系: IPv6プレフィックスとクォート": {
+			arg:  `/route[prefix="2001:db8::/32"][next-hop='a]/b']`,
+			want: []string{`route[prefix="2001:db8::/32"][next-hop='a]/b']`},
+		},
+		"正常系: ..はクリーンしない": {
+			arg:  "/A/../B",
+			want: []string{"A", "..", "B"},
+		},
+		"異常系: 相対パス": {
+			arg:     "A/B",
+			wantErr: true,
+		},
+		"異常系: 空のセグメント": {
+			arg:     "/A//B",
+			wantErr: true,
+		},
+		"異常系: 末尾の/": {
+			arg:     "/A/B/",
+			wantErr: true,
+		},
+		"異常系: 閉じていない述語": {
+			arg:     "/A[name=x/B",
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := SplitPath(tt.arg)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.arg, JoinPath(got))
+		})
+	}
+}
+
+func TestMatchSegment(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		pattern string
+		segment string
+		want    bool
+	}
+	tests := map[string]test{
+		"正常系: 一致":          {pattern: "interface[name=eth0]", segment: "interface[name=eth0]", want: true},
+		"正常系: キーのワイルドカード":  {pattern: "interface[name=*]", segment: "interface[name=eth0]", want: true},
+		"正常系: 名前のワイルドカード":  {pattern: "*", segment: "config", want: true},
+		"正常系: キーなしは全要素に一致": {pattern: "interface", segment: "interface[name=eth0]", want: true},
+		"正常系: キーの値が異なる":    {pattern: "interface[name=eth1]", segment: "interface[name=eth0]", want: false},
+		"正常系: キーがない要素":     {pattern: "interface[name=*]", segment: "interface", want: false},
+		"正常系: 名前が異なる":      {pattern: "config", segment: "state", want: false},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			pattern, err := ParseSegment(tt.pattern)
+			assert.Nil(t, err)
+			segment, err := ParseSegment(tt.segment)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, MatchSegment(pattern, segment))
+		})
+	}
+}
+
+func TestIsListKeyLeaf(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		segments []string
+		want     bool
+	}
+	tests := map[string]test{
+		"正常系: キーリーフ":       {segments: []string{"A", "E[F=f]", "F"}, want: true},
+		"正常系: 複数キーの2番目のキー": {segments: []string{"route[prefix=10.0.0.0/8][next-hop=1.1.1.1]", "next-hop"}, want: true},
+		"正常系: キー以外のリーフ":    {segments: []string{"E[F=f]", "G"}, want: false},
+		"正常系: コンテナのリーフ":    {segments: []string{"A", "F"}, want: false},
+		"正常系: 単一のセグメント":    {segments: []string{"F"}, want: false},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, IsListKeyLeaf(tt.segments))
+		})
+	}
+}
+
+func TestListKeysGet(t *testing.T) {
+	t.Parallel()
+	listKeys := ListKeys{"/routes/route": {"prefix", "next-hop"}}
+	type test struct {
+		path string
+		want []string
+	}
+	tests := map[string]test{
+		"正常系: スキーマパス":      {path: "/routes/route", want: []string{"prefix", "next-hop"}},
+		"正常系: キー述語とモジュール名": {path: "/m:routes[name=\"a/b\"]/route", want: []string{"prefix", "next-hop"}},
+		"正常系: 未知のリスト":      {path: "/routes/other"},
+		"正常系: 不正なパス":       {path: "routes/route"},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, listKeys.Get(tt.path))
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nttcom/ksot/nb-server/pkg/drift"
+)
+
+const (
+	// only record the drift
+	POLICY_REPORT = "report"
+	// push the intended value of drifted paths owned by a service, keep and report the rest of the device config
+	POLICY_REMEDIATE_OWNED = "remediate-owned"
+	// push the whole set.json
+	POLICY_REMEDIATE_ALL = "remediate-all"
+)
+
+const (
+	SKIPPED_EXCLUDED = "excluded"
+	SKIPPED_BUSY     = "busy"
+)
+
+type Config struct {
+	Interval       time.Duration
+	Policy         string
+	ExcludeDevices []string
+	MaxConcurrency int
+}
+
+type Result struct {
+	Device          string        `json:"device"`
+	Policy          string        `json:"policy"`
+	Report          *drift.Report `json:"report,omitempty"`
+	Remediated      bool          `json:"remediated"`
+	RemediatedPaths []string      `json:"remediatedPaths,omitempty"`
+	// AcceptedPaths are the drifted paths owned by no service that remediate-owned leaves on the device.
+	// They are not written into set.json.
+	AcceptedPaths []string  `json:"acceptedPaths,omitempty"`
+	Skipped       string    `json:"skipped,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	ReconciledAt  time.Time `json:"reconciledAt"`
+}
+
+// ListDevicesFunc returns the device names and their interfaces.
+type ListDevicesFunc func() (map[string]string, error)
+
+// ReconcileFunc detects the drift of a single device and remediates it according to policy.
+type ReconcileFunc func(deviceName string, iface string, policy string) *Result
+
+type ReconcilerInterface interface {
+	Run(ctx context.Context)
+	RunOnce() ([]*Result, error)
+	Results() []*Result
+}
+
+type Reconciler struct {
+	cfg         Config
+	excluded    map[string]bool
+	listDevices ListDevicesFunc
+	reconcile   ReconcileFunc
+	mu          sync.Mutex
+	results     map[string]*Result
+}
+
+var _ ReconcilerInterface = (*Reconciler)(nil)
+
+func New(cfg Config, listDevices ListDevicesFunc, reconcile ReconcileFunc) (*Reconciler, error) {
+	switch cfg.Policy {
+	case POLICY_REPORT, POLICY_REMEDIATE_OWNED, POLICY_REMEDIATE_ALL:
+	default:
+		return nil, fmt.Errorf("New: noexpected reconcile policy %v", cfg.Policy)
+	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = 1
+	}
+	excluded := make(map[string]bool)
+	for _, v := range cfg.ExcludeDevices {
+		excluded[v] = true
+	}
+	return &Reconciler{
+		cfg:         cfg,
+		excluded:    excluded,
+		listDevices: listDevices,
+		reconcile:   reconcile,
+		results:     make(map[string]*Result),
+	}, nil
+}
+
+// Run reconciles every device each interval until ctx is done. It does nothing if the interval is not positive.
+func (r *Reconciler) Run(ctx context.Context) {
+	if r.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.RunOnce(); err != nil {
+				fmt.Println("Reconciler: ", err)
+			}
+		}
+	}
+}
+
+// RunOnce reconciles every device with at most MaxConcurrency devices in parallel.
+func (r *Reconciler) RunOnce() ([]*Result, error) {
+	deviceInfos, err := r.listDevices()
+	if err != nil {
+		return nil, fmt.Errorf("RunOnce: %w", err)
+	}
+	results := make([]*Result, 0, len(deviceInfos))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, r.cfg.MaxConcurrency)
+	for deviceName, iface := range deviceInfos {
+		var result *Result
+		if r.excluded[deviceName] {
+			result = &Result{Device: deviceName, Policy: r.cfg.Policy, Skipped: SKIPPED_EXCLUDED, ReconciledAt: time.Now()}
+			r.record(result)
+			results = append(results, result)
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(deviceName string, iface string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			result := r.reconcile(deviceName, iface, r.cfg.Policy)
+			r.record(result)
+			resultsMu.Lock()
+			results = append(results, result)
+			resultsMu.Unlock()
+		}(deviceName, iface)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Device < results[j].Device
+	})
+	return results, nil
+}
+
+func (r *Reconciler) record(result *Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[result.Device] = result
+}
+
+// Results returns the latest result of each device.
+func (r *Reconciler) Results() []*Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]*Result, 0, len(r.results))
+	for _, v := range r.results {
+		results = append(results, v)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Device < results[j].Device
+	})
+	return results
+}
@@ -0,0 +1,58 @@
+package reconciler
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOnce(t *testing.T) {
+	t.Parallel()
+	deviceInfos := map[string]string{
+		"deviceA": "netconf",
+		"deviceB": "netconf",
+		"deviceC": "netconf",
+		"deviceD": "netconf",
+	}
+	var running, maxRunning int32
+	var mu sync.Mutex
+	reconciled := make([]string, 0)
+	reconcile := func(deviceName string, iface string, policy string) *Result {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		mu.Lock()
+		reconciled = append(reconciled, deviceName)
+		mu.Unlock()
+		return &Result{Device: deviceName, Policy: policy}
+	}
+	listDevices := func() (map[string]string, error) {
+		return deviceInfos, nil
+	}
+	r, err := New(Config{Policy: POLICY_REPORT, ExcludeDevices: []string{"deviceC"}, MaxConcurrency: 2}, listDevices, reconcile)
+	assert.Nil(t, err)
+
+	results, err := r.RunOnce()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, "deviceC", results[2].Device)
+	assert.Equal(t, SKIPPED_EXCLUDED, results[2].Skipped)
+	assert.ElementsMatch(t, []string{"deviceA", "deviceB", "deviceD"}, reconciled)
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(2))
+	assert.Equal(t, results, r.Results())
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := New(Config{Policy: "none"}, nil, nil)
+	assert.NotNil(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/nttcom/ksot/nb-server/pkg/api"
+	"github.com/nttcom/ksot/nb-server/pkg/config"
 	"github.com/nttcom/ksot/nb-server/pkg/util/libyang"
 )
 
@@ -15,7 +16,7 @@ var _ SyncInterface = (*SyncNetconf)(nil)
 
 func (syncNetconf *SyncNetconf) SyncDevice(sb api.SbApiInterface, lb libyang.LibyangInterface, deviceName string) ([]byte, error) {
 	path := fmt.Sprintf("/devices/%v", deviceName)
-	xml, err := sb.GetRequest(path, 120)
+	xml, err := sb.GetRequest(path, config.Cfg.DeviceTimeout)
 	if err != nil {
 		return []byte{}, fmt.Errorf("SyncDevice %v (netconf): %w", deviceName, err)
 	}
@@ -5,9 +5,12 @@ import (
 )
 
 var TfLogic = model.NewPathMapLogic()
+var ServiceOptions = model.NewServiceOptions()
 
 func init() {
 	// User needs to create a function to generate a pathmap and add it to the MAP.
 	// Example.
 	// TfLogic["serviceName"] = serviceName
+	// The conflict policy of a service can be declared in the same way.
+	// ServiceOptions["serviceName"] = map[string]string{pathmap.OPTION_CONFLICT_POLICY: pathmap.CONFLICT_POLICY_PRIORITY, pathmap.OPTION_PRIORITY: "10"}
 }
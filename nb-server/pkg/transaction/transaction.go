@@ -0,0 +1,250 @@
+package transaction
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nttcom/ksot/nb-server/pkg/apierror"
+	"github.com/nttcom/ksot/nb-server/pkg/diff"
+	"github.com/nttcom/ksot/nb-server/pkg/guard"
+	"github.com/nttcom/ksot/nb-server/pkg/model/pathmap"
+)
+
+type Phase string
+
+const (
+	PhaseQueued    Phase = "queued"
+	PhaseTfLogic   Phase = "tf-logic"
+	PhaseComposite Phase = "composite"
+	PhaseConfigure Phase = "configure"
+	PhaseCommit    Phase = "commit"
+	PhaseDone      Phase = "done"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+const (
+	DeviceStatusPlanned    = "planned"
+	DeviceStatusConfigured = "configured"
+	DeviceStatusRolledBack = "rolled-back"
+	DeviceStatusFailed     = "failed"
+	DeviceStatusCommitted  = "committed"
+)
+
+type DeviceResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Transaction records the progress of a single service change.
+type Transaction struct {
+	mu        sync.Mutex
+	ID        string                  `json:"id"`
+	Operation string                  `json:"operation"`
+	Services  []string                `json:"services"`
+	Phase     Phase                   `json:"phase"`
+	Status    Status                  `json:"status"`
+	Devices   []string                `json:"devices"`
+	Results   map[string]DeviceResult `json:"results"`
+	// Resolutions are the contested leaves and the services that won them.
+	Resolutions []pathmap.Resolution `json:"resolutions,omitempty"`
+	// Diffs are the diffs of the set.json of each device.
+	Diffs map[string]*diff.Rendering `json:"diffs,omitempty"`
+	// Claimed are the unmanaged paths of each device taken over by the change.
+	Claimed   map[string][]guard.Claim `json:"claimed,omitempty"`
+	Errors    []string                 `json:"errors"`
+	Error     *apierror.Error          `json:"error,omitempty"`
+	CreatedAt time.Time                `json:"createdAt"`
+	UpdatedAt time.Time                `json:"updatedAt"`
+}
+
+func New(operation string, services []string) *Transaction {
+	now := time.Now()
+	return &Transaction{
+		ID:        newID(),
+		Operation: operation,
+		Services:  services,
+		Phase:     PhaseQueued,
+		Status:    StatusRunning,
+		Devices:   make([]string, 0),
+		Results:   make(map[string]DeviceResult),
+		Errors:    make([]string, 0),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+func (t *Transaction) SetPhase(phase Phase) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Phase = phase
+	t.UpdatedAt = time.Now()
+}
+
+func (t *Transaction) SetDevices(devices []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Devices = append(make([]string, 0, len(devices)), devices...)
+	sort.Strings(t.Devices)
+	for _, deviceName := range t.Devices {
+		t.Results[deviceName] = DeviceResult{Status: DeviceStatusPlanned}
+	}
+	t.UpdatedAt = time.Now()
+}
+
+func (t *Transaction) SetResolutions(resolutions []pathmap.Resolution) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Resolutions = append(make([]pathmap.Resolution, 0, len(resolutions)), resolutions...)
+	t.UpdatedAt = time.Now()
+}
+
+func (t *Transaction) SetDiffs(diffs map[string]*diff.Rendering) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Diffs = make(map[string]*diff.Rendering, len(diffs))
+	for k, v := range diffs {
+		t.Diffs[k] = v
+	}
+	t.UpdatedAt = time.Now()
+}
+
+func (t *Transaction) SetClaimed(claimed map[string][]guard.Claim) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Claimed = make(map[string][]guard.Claim, len(claimed))
+	for k, v := range claimed {
+		t.Claimed[k] = v
+	}
+	t.UpdatedAt = time.Now()
+}
+
+func (t *Transaction) SetDeviceResult(deviceName string, result DeviceResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Results[deviceName] = result
+	t.UpdatedAt = time.Now()
+}
+
+// Fail marks the transaction as failed in its current phase.
+func (t *Transaction) Fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	apiErr := apierror.From(err)
+	if apiErr.Phase == "" {
+		apiErr.Phase = string(t.Phase)
+	}
+	t.Status = StatusFailed
+	t.Errors = append(t.Errors, apiErr.Message)
+	t.Error = apiErr
+	t.UpdatedAt = time.Now()
+}
+
+func (t *Transaction) Succeed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Phase = PhaseDone
+	t.Status = StatusSucceeded
+	t.UpdatedAt = time.Now()
+}
+
+// Snapshot returns a copy of the transaction that is safe to read while the transaction is running.
+func (t *Transaction) Snapshot() *Transaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := &Transaction{
+		ID:          t.ID,
+		Operation:   t.Operation,
+		Services:    append(make([]string, 0, len(t.Services)), t.Services...),
+		Phase:       t.Phase,
+		Status:      t.Status,
+		Devices:     append(make([]string, 0, len(t.Devices)), t.Devices...),
+		Results:     make(map[string]DeviceResult),
+		Errors:      append(make([]string, 0, len(t.Errors)), t.Errors...),
+		Error:       t.Error,
+		Resolutions: t.Resolutions,
+		Diffs:       t.Diffs,
+		Claimed:     t.Claimed,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+	for k, v := range t.Results {
+		result.Results[k] = v
+	}
+	return result
+}
+
+type StoreInterface interface {
+	Create(operation string, services []string) *Transaction
+	Get(id string) (*Transaction, bool)
+	List() []*Transaction
+}
+
+// Store keeps the most recent transactions in memory.
+type Store struct {
+	mu           sync.Mutex
+	size         int
+	transactions map[string]*Transaction
+	order        []string
+}
+
+var _ StoreInterface = (*Store)(nil)
+
+func NewStore(size int) *Store {
+	return &Store{
+		size:         size,
+		transactions: make(map[string]*Transaction),
+		order:        make([]string, 0),
+	}
+}
+
+func (s *Store) Create(operation string, services []string) *Transaction {
+	t := New(operation, services)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions[t.ID] = t
+	s.order = append(s.order, t.ID)
+	for s.size > 0 && len(s.order) > s.size {
+		delete(s.transactions, s.order[0])
+		s.order = s.order[1:]
+	}
+	return t
+}
+
+func (s *Store) Get(id string) (*Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.transactions[id]
+	if !ok {
+		return nil, false
+	}
+	return t.Snapshot(), true
+}
+
+// List returns snapshots of the stored transactions, newest first.
+func (s *Store) List() []*Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]*Transaction, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		result = append(result, s.transactions[s.order[i]].Snapshot())
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package transaction
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+	tx := New("update", []string{"serviceA"})
+	assert.Equal(t, PhaseQueued, tx.Phase)
+	assert.Equal(t, StatusRunning, tx.Status)
+
+	tx.SetPhase(PhaseTfLogic)
+	tx.SetDevices([]string{"deviceB", "deviceA"})
+	tx.SetPhase(PhaseConfigure)
+	tx.SetDeviceResult("deviceA", DeviceResult{Status: DeviceStatusFailed, Error: "timeout"})
+	tx.Fail(errors.New("configure failed"))
+
+	snapshot := tx.Snapshot()
+	assert.Equal(t, PhaseConfigure, snapshot.Phase)
+	assert.Equal(t, StatusFailed, snapshot.Status)
+	assert.Equal(t, []string{"deviceA", "deviceB"}, snapshot.Devices)
+	assert.Equal(t, map[string]DeviceResult{
+		"deviceA": {Status: DeviceStatusFailed, Error: "timeout"},
+		"deviceB": {Status: DeviceStatusPlanned},
+	}, snapshot.Results)
+	assert.Equal(t, []string{"configure failed"}, snapshot.Errors)
+	assert.Equal(t, "internal", snapshot.Error.Code)
+	assert.Equal(t, string(PhaseConfigure), snapshot.Error.Phase)
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		size      int
+		creates   int
+		wantCount int
+	}
+	tests := map[string]test{
+		"正常系: 上限以内":  {size: 3, creates: 2, wantCount: 2},
+		"正常系: 上限超過時": {size: 3, creates: 5, wantCount: 3},
+		"正常系: 上限なし":  {size: 0, creates: 5, wantCount: 5},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			store := NewStore(tt.size)
+			ids := make([]string, 0)
+			for i := 0; i < tt.creates; i++ {
+				ids = append(ids, store.Create("create", []string{"serviceA"}).ID)
+			}
+			list := store.List()
+			assert.Equal(t, tt.wantCount, len(list))
+			// newest first
+			assert.Equal(t, ids[len(ids)-1], list[0].ID)
+			_, ok := store.Get(ids[len(ids)-1])
+			assert.True(t, ok)
+			_, ok = store.Get(ids[0])
+			assert.Equal(t, tt.creates <= tt.wantCount, ok)
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/orderedmap"
+)
+
+const (
+	OP_ADD     = "add"
+	OP_REMOVE  = "remove"
+	OP_REPLACE = "replace"
+	OP_MOVE    = "move"
+	OP_COPY    = "copy"
+	OP_TEST    = "test"
+)
+
+// Operation is a single operation of a RFC 6902 JSON Patch document.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// DecodeValue decodes any JSON value, keeping the key order of objects as orderedmap.OrderedMap.
+func DecodeValue(b []byte) (any, error) {
+	wrapper := orderedmap.New()
+	var buf bytes.Buffer
+	buf.WriteString(`{"v":`)
+	buf.Write(b)
+	buf.WriteString(`}`)
+	if err := json.Unmarshal(buf.Bytes(), wrapper); err != nil {
+		return nil, fmt.Errorf("DecodeValue: %w", err)
+	}
+	v, _ := wrapper.Get("v")
+	return v, nil
+}
+
+func deepCopy(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("deepCopy: %w", err)
+	}
+	return DecodeValue(b)
+}
+
+// MergePatch applies a RFC 7396 JSON Merge Patch to target and returns the result. target is not modified.
+func MergePatch(target any, patch []byte) (any, error) {
+	patchValue, err := DecodeValue(patch)
+	if err != nil {
+		return nil, fmt.Errorf("MergePatch: %w", err)
+	}
+	copied, err := deepCopy(target)
+	if err != nil {
+		return nil, fmt.Errorf("MergePatch: %w", err)
+	}
+	return mergePatch(copied, patchValue), nil
+}
+
+func mergePatch(target any, patch any) any {
+	patchMap, ok := patch.(orderedmap.OrderedMap)
+	if !ok {
+		return patch
+	}
+	targetMap, ok := target.(orderedmap.OrderedMap)
+	if !ok {
+		targetMap = *orderedmap.New()
+	}
+	for _, k := range patchMap.Keys() {
+		v, _ := patchMap.Get(k)
+		if v == nil {
+			targetMap.Delete(k)
+			continue
+		}
+		tv, _ := targetMap.Get(k)
+		targetMap.Set(k, mergePatch(tv, v))
+	}
+	return targetMap
+}
+
+// ApplyPatch applies a RFC 6902 JSON Patch document to target and returns the result. target is not modified.
+func ApplyPatch(target any, patch []byte) (any, error) {
+	ops := make([]Operation, 0)
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("ApplyPatch: %w", err)
+	}
+	doc, err := deepCopy(target)
+	if err != nil {
+		return nil, fmt.Errorf("ApplyPatch: %w", err)
+	}
+	for i, op := range ops {
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("ApplyPatch: operation %v: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case OP_ADD:
+		value, err := operationValue(op)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case OP_REMOVE:
+		return remove(doc, path)
+	case OP_REPLACE:
+		value, err := operationValue(op)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+		doc, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case OP_MOVE, OP_COPY:
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == OP_COPY {
+			value, err = deepCopy(value)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, fmt.Errorf("move: %v is a child of %v", op.Path, op.From)
+		}
+		doc, err = remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case OP_TEST:
+		value, err := operationValue(op)
+		if err != nil {
+			return nil, err
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(current, value) {
+			return nil, fmt.Errorf("test: %v is not %v", op.Path, string(op.Value))
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("noexpected op %v", op.Op)
+	}
+}
+
+func operationValue(op Operation) (any, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("%v: value is required", op.Op)
+	}
+	return DecodeValue(op.Value)
+}
+
+// parsePointer parses a RFC 6901 JSON Pointer.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("parsePointer: noexpected pointer %v", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, v := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(v, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("noexpected array index %v", token)
+	}
+	if index > length || (!allowEnd && index == length) {
+		return 0, fmt.Errorf("array index %v out of range", token)
+	}
+	return index, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return doc, nil
+	}
+	switch v := doc.(type) {
+	case orderedmap.OrderedMap:
+		child, ok := v.Get(path[0])
+		if !ok {
+			return nil, fmt.Errorf("not found %v", path[0])
+		}
+		return get(child, path[1:])
+	case []interface{}:
+		index, err := arrayIndex(path[0], len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		return get(v[index], path[1:])
+	default:
+		return nil, fmt.Errorf("not found %v", path[0])
+	}
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch v := doc.(type) {
+	case orderedmap.OrderedMap:
+		if len(path) == 1 {
+			v.Set(path[0], value)
+			return v, nil
+		}
+		child, ok := v.Get(path[0])
+		if !ok {
+			return nil, fmt.Errorf("not found %v", path[0])
+		}
+		newChild, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v.Set(path[0], newChild)
+		return v, nil
+	case []interface{}:
+		if len(path) == 1 {
+			index, err := arrayIndex(path[0], len(v), true)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]interface{}, 0, len(v)+1)
+			result = append(result, v[:index]...)
+			result = append(result, value)
+			return append(result, v[index:]...), nil
+		}
+		index, err := arrayIndex(path[0], len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		newChild, err := add(v[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[index] = newChild
+		return v, nil
+	default:
+		return nil, fmt.Errorf("not found %v", path[0])
+	}
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("remove: root can not be removed")
+	}
+	switch v := doc.(type) {
+	case orderedmap.OrderedMap:
+		child, ok := v.Get(path[0])
+		if !ok {
+			return nil, fmt.Errorf("not found %v", path[0])
+		}
+		if len(path) == 1 {
+			v.Delete(path[0])
+			return v, nil
+		}
+		newChild, err := remove(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v.Set(path[0], newChild)
+		return v, nil
+	case []interface{}:
+		index, err := arrayIndex(path[0], len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			result := make([]interface{}, 0, len(v)-1)
+			result = append(result, v[:index]...)
+			return append(result, v[index+1:]...), nil
+		}
+		newChild, err := remove(v[index], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[index] = newChild
+		return v, nil
+	default:
+		return nil, fmt.Errorf("not found %v", path[0])
+	}
+}
+
+// Equal compares two decoded JSON values. The key order of objects is ignored.
+func Equal(x, y any) bool {
+	switch vx := x.(type) {
+	case orderedmap.OrderedMap:
+		vy, ok := y.(orderedmap.OrderedMap)
+		if !ok || len(vx.Keys()) != len(vy.Keys()) {
+			return false
+		}
+		for _, k := range vx.Keys() {
+			xv, _ := vx.Get(k)
+			yv, ok := vy.Get(k)
+			if !ok || !Equal(xv, yv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		vy, ok := y.([]interface{})
+		if !ok || len(vx) != len(vy) {
+			return false
+		}
+		for i := range vx {
+			if !Equal(vx[i], vy[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(x, y)
+	}
+}
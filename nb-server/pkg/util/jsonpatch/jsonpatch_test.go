@@ -0,0 +1,77 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTarget = `{"name":"a","mtu":1500,"vlans":[10,20],"config":{"enabled":true,"description":"x"}}`
+
+func TestMergePatch(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		patch string
+		want  string
+	}
+	tests := map[string]test{
+		"正常系: leafの更新":   {patch: `{"mtu":9000}`, want: `{"name":"a","mtu":9000,"vlans":[10,20],"config":{"enabled":true,"description":"x"}}`},
+		"正常系: nullで削除":   {patch: `{"config":{"description":null}}`, want: `{"name":"a","mtu":1500,"vlans":[10,20],"config":{"enabled":true}}`},
+		"正常系: 配列は置き換え":   {patch: `{"vlans":[30]}`, want: `{"name":"a","mtu":1500,"vlans":[30],"config":{"enabled":true,"description":"x"}}`},
+		"正常系: 新しいkeyの追加": {patch: `{"new":{"a":1}}`, want: `{"name":"a","mtu":1500,"vlans":[10,20],"config":{"enabled":true,"description":"x"},"new":{"a":1}}`},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			target, err := DecodeValue([]byte(testTarget))
+			assert.Nil(t, err)
+			result, err := MergePatch(target, []byte(tt.patch))
+			assert.Nil(t, err)
+			resultByte, err := json.Marshal(result)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, string(resultByte))
+			// target is not modified
+			targetByte, err := json.Marshal(target)
+			assert.Nil(t, err)
+			assert.Equal(t, testTarget, string(targetByte))
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		patch   string
+		want    string
+		wantErr bool
+	}
+	tests := map[string]test{
+		"正常系: add":       {patch: `[{"op":"add","path":"/vlans/-","value":30}]`, want: `{"name":"a","mtu":1500,"vlans":[10,20,30],"config":{"enabled":true,"description":"x"}}`},
+		"正常系: remove":    {patch: `[{"op":"remove","path":"/config/description"}]`, want: `{"name":"a","mtu":1500,"vlans":[10,20],"config":{"enabled":true}}`},
+		"正常系: replace":   {patch: `[{"op":"replace","path":"/vlans/0","value":11}]`, want: `{"name":"a","mtu":1500,"vlans":[11,20],"config":{"enabled":true,"description":"x"}}`},
+		"正常系: move":      {patch: `[{"op":"move","from":"/mtu","path":"/config/mtu"}]`, want: `{"name":"a","vlans":[10,20],"config":{"enabled":true,"description":"x","mtu":1500}}`},
+		"正常系: copyとtest": {patch: `[{"op":"test","path":"/config","value":{"description":"x","enabled":true}},{"op":"copy","from":"/name","path":"/alias"}]`, want: `{"name":"a","mtu":1500,"vlans":[10,20],"config":{"enabled":true,"description":"x"},"alias":"a"}`},
+		"異常系: test失敗":    {patch: `[{"op":"test","path":"/mtu","value":9000}]`, wantErr: true},
+		"異常系: 存在しないpath": {patch: `[{"op":"replace","path":"/none","value":1}]`, wantErr: true},
+		"異常系: 範囲外のindex": {patch: `[{"op":"add","path":"/vlans/5","value":1}]`, wantErr: true},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			target, err := DecodeValue([]byte(testTarget))
+			assert.Nil(t, err)
+			result, err := ApplyPatch(target, []byte(tt.patch))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			resultByte, err := json.Marshal(result)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, string(resultByte))
+		})
+	}
+}
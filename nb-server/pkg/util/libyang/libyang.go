@@ -7,6 +7,9 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
 )
 
 type LibyangInterface interface {
@@ -14,18 +17,23 @@ type LibyangInterface interface {
 	ValidateAndConvertXMLToJSON(deviceName string, xml []byte) (bool, []byte, error)
 	ValidateAndConvertJSONToXML(deviceName string, jsonFile []byte) (bool, []byte, error)
 	ValidateJsonForYang(deviceName string, jsonFile []byte) (bool, error)
+	// ListKeys returns the keys of every list of the device models, read once per device.
+	ListKeys(deviceName string) (yangpath.ListKeys, error)
 }
 
 type libyang struct {
+	// mu serializes the use of the temporary files
+	mu                    sync.Mutex
 	yangFolderPath        string
 	temporaryXmlFilePath  string
 	temporaryJsonFilePath string
+	listKeys              map[string]yangpath.ListKeys
 }
 
 var _ LibyangInterface = (*libyang)(nil)
 
 func New(yangFolderPath string, temporaryXmlFilePath string, temporaryJsonFilePath string) *libyang {
-	return &libyang{yangFolderPath: yangFolderPath, temporaryXmlFilePath: temporaryXmlFilePath, temporaryJsonFilePath: temporaryJsonFilePath}
+	return &libyang{yangFolderPath: yangFolderPath, temporaryXmlFilePath: temporaryXmlFilePath, temporaryJsonFilePath: temporaryJsonFilePath, listKeys: make(map[string]yangpath.ListKeys)}
 }
 
 func searchYangFiles(yangFolderPath string, kind string, deviceName string) ([]string, error) {
@@ -41,6 +49,8 @@ func searchYangFiles(yangFolderPath string, kind string, deviceName string) ([]s
 }
 
 func (l *libyang) ValidateAndConvertXMLToJSON(deviceName string, xml []byte) (bool, []byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	f, err := os.Create(l.temporaryXmlFilePath)
 	defer os.Remove(l.temporaryXmlFilePath)
 	if err != nil {
@@ -63,6 +73,8 @@ func (l *libyang) ValidateAndConvertXMLToJSON(deviceName string, xml []byte) (bo
 }
 
 func (l *libyang) ValidateAndConvertJSONToXML(deviceName string, jsonFile []byte) (bool, []byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	f, err := os.Create(l.temporaryJsonFilePath)
 	defer os.Remove(l.temporaryJsonFilePath)
 	if err != nil {
@@ -85,6 +97,8 @@ func (l *libyang) ValidateAndConvertJSONToXML(deviceName string, jsonFile []byte
 }
 
 func (l *libyang) ValidateJsonForYang(deviceName string, jsonFile []byte) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	f, err := os.Create(l.temporaryJsonFilePath)
 	defer os.Remove(l.temporaryJsonFilePath)
 	if err != nil {
@@ -105,3 +119,85 @@ func (l *libyang) ValidateJsonForYang(deviceName string, jsonFile []byte) (bool,
 	}
 	return true, nil
 }
+
+func (l *libyang) ListKeys(deviceName string) (yangpath.ListKeys, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if result, ok := l.listKeys[deviceName]; ok {
+		return result, nil
+	}
+	yangFiles, err := searchYangFiles(l.yangFolderPath, "devices", deviceName)
+	if err != nil {
+		return nil, fmt.Errorf("ListKeys: %w", err)
+	}
+	command := append([]string{"--format", "tree", "--tree-line-length", "1000"}, yangFiles...)
+	out, err := exec.Command("yanglint", command...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ListKeys: yanglint error: %v", string(out))
+	}
+	result := parseTreeListKeys(string(out))
+	l.listKeys[deviceName] = result
+	return result, nil
+}
+
+// parseTreeListKeys returns the keys of the lists in the tree format of yanglint such as "+--rw route* [prefix next-hop]".
+// The nodes of a module and of its augments are read, and choice and case nodes are not part of a path.
+func parseTreeListKeys(tree string) yangpath.ListKeys {
+	type node struct {
+		column int
+		path   string
+	}
+	result := make(yangpath.ListKeys)
+	var base string
+	active := false
+	stack := make([]node, 0)
+	for _, line := range strings.Split(tree, "\n") {
+		column := strings.Index(line, "+--")
+		if column < 0 {
+			header := strings.TrimSpace(line)
+			switch {
+			case header == "":
+				continue
+			case strings.HasPrefix(header, "module:") || strings.HasPrefix(header, "submodule:"):
+				base, active = "", true
+			case strings.HasPrefix(header, "augment "):
+				target, err := yangpath.SchemaPath(strings.TrimSuffix(strings.TrimPrefix(header, "augment "), ":"))
+				base, active = target, err == nil
+			default:
+				// rpcs, notifications and groupings are not config
+				active = false
+			}
+			stack = stack[:0]
+			continue
+		}
+		if !active {
+			continue
+		}
+		for len(stack) != 0 && stack[len(stack)-1].column >= column {
+			stack = stack[:len(stack)-1]
+		}
+		parent := base
+		if len(stack) != 0 {
+			parent = stack[len(stack)-1].path
+		}
+		fields := strings.Fields(line[column+3:])
+		if len(fields) < 2 || strings.HasPrefix(fields[0], ":(") || strings.HasPrefix(fields[1], "(") {
+			stack = append(stack, node{column: column, path: parent})
+			continue
+		}
+		name := strings.TrimRight(fields[1], "?*!")
+		if _, after, ok := strings.Cut(name, ":"); ok {
+			name = after
+		}
+		path := strings.TrimSuffix(parent, "/") + "/" + name
+		stack = append(stack, node{column: column, path: path})
+		rest := strings.TrimSpace(strings.Join(fields[2:], " "))
+		if !strings.HasSuffix(fields[1], "*") || !strings.HasPrefix(rest, "[") {
+			continue
+		}
+		if end := strings.IndexByte(rest, ']'); end > 0 {
+			result[path] = strings.Fields(rest[1:end])
+		}
+	}
+	return result
+}
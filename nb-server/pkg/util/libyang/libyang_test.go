@@ -0,0 +1,62 @@
+package libyang
+
+import (
+	"testing"
+
+	"github.com/nttcom/ksot/nb-server/pkg/model/yangpath"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTreeListKeys(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		tree string
+		want yangpath.ListKeys
+	}
+	tests := map[string]test{
+		"正常系: 複数キーのlistとchoice": {
+			tree: `module: example-routing
+  +--rw routes
+     +--rw route* [prefix next-hop]
+     |  +--rw prefix      string
+     |  +--rw next-hop    string
+     |  +--rw (kind)?
+     |     +--:(static)
+     |        +--rw tag* [id]
+     |           +--rw id    uint32
+     +--rw names*   string
+`,
+			want: yangpath.ListKeys{
+				"/routes/route":     {"prefix", "next-hop"},
+				"/routes/route/tag": {"id"},
+			},
+		},
+		"正常系: augmentとrpcs": {
+			tree: `module: example-interfaces
+  +--rw interfaces
+     +--rw interface* [name]
+        +--rw name    string
+
+  augment /if:interfaces/if:interface:
+    +--rw ex:address* [ip]
+       +--rw ex:ip    string
+
+  rpcs:
+    +---x reset
+       +---w input
+          +---w entry* [id]
+`,
+			want: yangpath.ListKeys{
+				"/interfaces/interface":         {"name"},
+				"/interfaces/interface/address": {"ip"},
+			},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, parseTreeListKeys(tt.tree))
+		})
+	}
+}